@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/catouc/gitlab-ci-crawler/internal/bump"
 	"github.com/catouc/gitlab-ci-crawler/internal/crawler"
+	"github.com/catouc/gitlab-ci-crawler/internal/report"
 	"github.com/catouc/gitlab-ci-crawler/internal/storage"
 	"github.com/catouc/gitlab-ci-crawler/internal/storage/neo4j"
 	"github.com/rs/zerolog"
@@ -64,13 +67,133 @@ func main() {
 		storageLogger.Fatal().Msgf("unknown storage: %s", cfg.Storage)
 	}
 
+	switch cfg.Args.Num(0) {
+	case "", "crawl":
+		crawl(rootCtx, s)
+	case "report":
+		runReport(rootCtx, s, cfg.Args.Num(1))
+	case "bump":
+		var consumers []string
+		if len(cfg.Args) > 3 {
+			consumers = cfg.Args[3:]
+		}
+		runBump(rootCtx, s, cfg.Args.Num(1), cfg.Args.Num(2), consumers)
+	default:
+		log.Fatal().Msgf("unknown command: %s", cfg.Args.Num(0))
+	}
+}
+
+func crawl(ctx context.Context, s storage.Storage) {
 	c, err := crawler.New(&cfg, log.Logger, s)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to setup crawler")
 	}
 	log.Info().Str("Storage", cfg.Storage).Msg("successfully configured crawler with storage")
 
-	if err := c.Crawl(rootCtx); err != nil {
+	if err := c.Crawl(ctx); err != nil {
+		if errors.Is(err, crawler.ErrTooManyFailures) {
+			log.Error().Err(err).Msg("crawl finished with too many failures")
+			os.Exit(2)
+		}
 		log.Fatal().Err(err).Msg("failed to gather project data")
 	}
 }
+
+// runReport answers one of the questions the graph was built for and writes the
+// answer to stdout in the configured ReportFormat.
+func runReport(ctx context.Context, s storage.Storage, name string) {
+	reader, ok := s.(storage.Reader)
+	if !ok {
+		log.Fatal().Msgf("storage %s does not support reports", cfg.Storage)
+	}
+
+	switch name {
+	case "outdated":
+		tags := report.GitLabTags{Client: crawler.NewGitLabClient(&cfg, log.Logger)}
+
+		templates, err := report.Outdated(ctx, reader, tags)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to build outdated report")
+		}
+
+		if err := report.WriteOutdated(os.Stdout, cfg.ReportFormat, templates); err != nil {
+			log.Fatal().Err(err).Msg("failed to write outdated report")
+		}
+	case "broken":
+		namespaces, err := report.Broken(ctx, reader)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to build broken includes report")
+		}
+
+		if err := report.WriteBroken(os.Stdout, cfg.ReportFormat, namespaces); err != nil {
+			log.Fatal().Err(err).Msg("failed to write broken includes report")
+		}
+	default:
+		log.Fatal().Msgf("unknown report: %s", name)
+	}
+}
+
+// runBump moves the includes of the template project to ref in every consumer
+// and opens a merge request for each of them. Without explicit consumers every
+// project including the template according to the graph is bumped.
+func runBump(ctx context.Context, s storage.Storage, template, ref string, consumers []string) {
+	if template == "" || ref == "" {
+		log.Fatal().Msg("usage: bump <template-project> <ref> [consumer...]")
+	}
+
+	if len(consumers) == 0 {
+		reader, ok := s.(storage.Reader)
+		if !ok {
+			log.Fatal().Msgf("storage %s cannot list consumers, pass them explicitly", cfg.Storage)
+		}
+
+		var err error
+		consumers, err = consumersOf(ctx, reader, template)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to list consumers")
+		}
+	}
+
+	b := bump.Bumper{
+		Client: crawler.NewGitLabClient(&cfg, log.Logger),
+		Logger: log.Logger,
+		DryRun: cfg.BumpDryRun,
+		Out:    os.Stdout,
+	}
+
+	failed := 0
+	for _, consumer := range consumers {
+		if _, err := b.Bump(ctx, consumer, template, ref); err != nil {
+			log.Err(err).Str("Consumer", consumer).Msg("failed to bump consumer")
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Fatal().Msgf("failed to bump %d of %d consumers", failed, len(consumers))
+	}
+}
+
+// consumersOf returns every project including a file of the template project,
+// component includes are skipped since bump only rewrites `project:` includes.
+func consumersOf(ctx context.Context, reader storage.Reader, template string) ([]string, error) {
+	includes, err := reader.ListProjectIncludes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	consumers := make([]string, 0)
+	for _, i := range includes {
+		if i.TargetProject != template || i.Component != "" {
+			continue
+		}
+		if _, ok := seen[i.SourceProject]; ok {
+			continue
+		}
+		seen[i.SourceProject] = struct{}{}
+		consumers = append(consumers, i.SourceProject)
+	}
+
+	return consumers, nil
+}
@@ -0,0 +1,136 @@
+package bump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+)
+
+const defaultCIConfigPath = ".gitlab-ci.yml"
+
+// Bumper moves the includes of a template project in the CI files of its
+// consumers to a new ref by opening a merge request in every consumer.
+// In DryRun mode the changes are only written to Out as a diff.
+type Bumper struct {
+	Client *gitlab.Client
+	Logger zerolog.Logger
+	DryRun bool
+	Out    io.Writer
+}
+
+// Result describes what happened to a single consumer.
+type Result struct {
+	Consumer     string
+	File         string
+	Changes      []Change
+	MergeRequest gitlab.MergeRequest
+}
+
+var ErrCIConfigOutsideProject = errors.New("ci configuration is not stored inside the project")
+
+// Bump rewrites the CI configuration file of the consumer to include the
+// template project at ref. Consumers that already use ref are left alone.
+func (b *Bumper) Bump(ctx context.Context, consumer, template, ref string) (Result, error) {
+	result := Result{Consumer: consumer}
+
+	p, err := b.Client.GetProjectFromPath(ctx, consumer)
+	if err != nil {
+		return result, fmt.Errorf("failed to get project %s: %w", consumer, err)
+	}
+
+	result.File = p.CIConfigPath
+	if result.File == "" {
+		result.File = defaultCIConfigPath
+	}
+
+	// The configuration can live in another project or on another host,
+	// in both cases there is nothing to change in the consumer.
+	if strings.Contains(result.File, "@") || strings.Contains(result.File, "://") {
+		return result, fmt.Errorf("%s: %w", result.File, ErrCIConfigOutsideProject)
+	}
+
+	file, err := b.Client.GetRawFileFromProject(ctx, p.ID, result.File, p.DefaultBranch)
+	if err != nil {
+		return result, fmt.Errorf("failed to get %s: %w", result.File, err)
+	}
+
+	updated, changes, err := Rewrite(file, template, ref)
+	if err != nil {
+		return result, fmt.Errorf("failed to rewrite %s: %w", result.File, err)
+	}
+
+	result.Changes = changes
+	if len(changes) == 0 {
+		b.Logger.Info().
+			Str("Consumer", consumer).
+			Str("File", result.File).
+			Msg("nothing to bump")
+		return result, nil
+	}
+
+	if b.DryRun {
+		_, err := fmt.Fprintf(b.Out, "# %s\n%s", consumer, Diff(result.File, changes))
+		return result, err
+	}
+
+	branch := branchName(template, ref)
+	if err := b.Client.CreateBranch(ctx, p.ID, branch, p.DefaultBranch); err != nil {
+		return result, fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+
+	title := fmt.Sprintf("Bump %s to %s", template, ref)
+	if _, err := b.Client.CreateCommit(ctx, p.ID, branch, title, []gitlab.CommitAction{{
+		Action:   "update",
+		FilePath: strings.TrimPrefix(result.File, "/"),
+		Content:  string(updated),
+	}}); err != nil {
+		b.deleteBranch(ctx, p, branch)
+		return result, fmt.Errorf("failed to commit %s: %w", result.File, err)
+	}
+
+	result.MergeRequest, err = b.Client.CreateMergeRequest(ctx, p.ID, gitlab.MergeRequestOptions{
+		SourceBranch:       branch,
+		TargetBranch:       p.DefaultBranch,
+		Title:              title,
+		Description:        description(template, ref, result.File, changes),
+		RemoveSourceBranch: true,
+	})
+	if err != nil {
+		b.deleteBranch(ctx, p, branch)
+		return result, fmt.Errorf("failed to open merge request: %w", err)
+	}
+
+	b.Logger.Info().
+		Str("Consumer", consumer).
+		Str("MergeRequest", result.MergeRequest.WebURL).
+		Msg("opened merge request")
+
+	return result, nil
+}
+
+// deleteBranch removes the branch of a bump that failed half way, otherwise
+// the next run could not create it again.
+func (b *Bumper) deleteBranch(ctx context.Context, p gitlab.Project, branch string) {
+	if err := b.Client.DeleteBranch(ctx, p.ID, branch); err != nil {
+		b.Logger.Err(err).
+			Str("Consumer", p.PathWithNamespace).
+			Str("Branch", branch).
+			Msg("failed to delete branch of failed bump")
+	}
+}
+
+// branchName builds the name of the branch holding the bump, it is the same
+// for every consumer so reruns fail instead of opening a second merge request.
+func branchName(template, ref string) string {
+	return "bump/" + strings.ReplaceAll(template, "/", "-") + "-" + ref
+}
+
+func description(template, ref, file string, changes []Change) string {
+	return fmt.Sprintf("This moves the includes of `%s` in `%s` to `%s`.\n\n```diff\n%s```\n",
+		template, file, ref, Diff(file, changes))
+}
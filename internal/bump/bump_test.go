@@ -0,0 +1,145 @@
+package bump
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const consumerCIFile = `include:
+  - project: platform/ci
+    ref: v1.0.0 # pinned
+    file: /build.yml
+`
+
+// fakeGitLab serves the few endpoints Bump uses for a single consumer project
+// and records the bodies of all write requests by their path.
+type fakeGitLab struct {
+	requests map[string]map[string]interface{}
+	// failMergeRequest makes opening the merge request fail.
+	failMergeRequest bool
+	deleted          []string
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.requests[r.URL.Path] = body
+	}
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /api/v4/projects/team/app":
+		_, _ = io.WriteString(w, `{"id": 7, "default_branch": "main", "path_with_namespace": "team/app"}`)
+	case "GET /api/v4/projects/7/repository/files/.gitlab-ci.yml/raw":
+		_, _ = io.WriteString(w, consumerCIFile)
+	case "POST /api/v4/projects/7/repository/branches":
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"name": "bump/platform-ci-v2.0.0"}`)
+	case "POST /api/v4/projects/7/repository/commits":
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"id": "abc"}`)
+	case "POST /api/v4/projects/7/merge_requests":
+		if f.failMergeRequest {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = io.WriteString(w, `{"message": ["Another open merge request already exists"]}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"iid": 3, "web_url": "https://gitlab.example.com/team/app/-/merge_requests/3"}`)
+	case "DELETE /api/v4/projects/7/repository/branches/bump/platform-ci-v2.0.0":
+		f.deleted = append(f.deleted, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestBumper(t *testing.T, dryRun bool) (*Bumper, *fakeGitLab, *bytes.Buffer) {
+	fake := &fakeGitLab{requests: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	out := &bytes.Buffer{}
+	return &Bumper{
+		Client: gitlab.NewClient(server.URL, "token", server.Client(), zerolog.Nop()),
+		Logger: zerolog.Nop(),
+		DryRun: dryRun,
+		Out:    out,
+	}, fake, out
+}
+
+func TestBumper_Bump(t *testing.T) {
+	b, fake, out := newTestBumper(t, false)
+
+	result, err := b.Bump(context.Background(), "team/app", "platform/ci", "v2.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, ".gitlab-ci.yml", result.File)
+	assert.Len(t, result.Changes, 1)
+	assert.Equal(t, 3, result.MergeRequest.IID)
+	assert.Empty(t, out.String())
+
+	assert.Equal(t, map[string]interface{}{
+		"branch": "bump/platform-ci-v2.0.0",
+		"ref":    "main",
+	}, fake.requests["/api/v4/projects/7/repository/branches"])
+
+	commit := fake.requests["/api/v4/projects/7/repository/commits"]
+	assert.Equal(t, "bump/platform-ci-v2.0.0", commit["branch"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"action":    "update",
+		"file_path": ".gitlab-ci.yml",
+		"content":   "include:\n  - project: platform/ci\n    ref: v2.0.0 # pinned\n    file: /build.yml\n",
+	}}, commit["actions"])
+
+	mr := fake.requests["/api/v4/projects/7/merge_requests"]
+	assert.Equal(t, "bump/platform-ci-v2.0.0", mr["source_branch"])
+	assert.Equal(t, "main", mr["target_branch"])
+	assert.Equal(t, "Bump platform/ci to v2.0.0", mr["title"])
+	assert.Contains(t, mr["description"], "-    ref: v1.0.0 # pinned\n+    ref: v2.0.0 # pinned\n")
+}
+
+func TestBumper_BumpDeletesBranchOfFailedBump(t *testing.T) {
+	b, fake, _ := newTestBumper(t, false)
+	fake.failMergeRequest = true
+
+	_, err := b.Bump(context.Background(), "team/app", "platform/ci", "v2.0.0")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/api/v4/projects/7/repository/branches/bump%2Fplatform-ci-v2.0.0"}, fake.deleted)
+}
+
+func TestBumper_BumpDryRun(t *testing.T) {
+	b, fake, out := newTestBumper(t, true)
+
+	result, err := b.Bump(context.Background(), "team/app", "platform/ci", "v2.0.0")
+	assert.NoError(t, err)
+	assert.Len(t, result.Changes, 1)
+	assert.Empty(t, fake.requests)
+	assert.Equal(t, `# team/app
+--- a/.gitlab-ci.yml
++++ b/.gitlab-ci.yml
+@@ -3 +3 @@
+-    ref: v1.0.0 # pinned
++    ref: v2.0.0 # pinned
+`, out.String())
+}
+
+func TestBumper_BumpUpToDate(t *testing.T) {
+	b, fake, _ := newTestBumper(t, false)
+
+	result, err := b.Bump(context.Background(), "team/app", "platform/ci", "v1.0.0")
+	assert.NoError(t, err)
+	assert.Empty(t, result.Changes)
+	assert.Empty(t, fake.requests)
+}
@@ -0,0 +1,208 @@
+package bump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change is a single line of a CI file that was changed by Rewrite. Line is the
+// line number in the original file, lines that were added have no Old content
+// and are added after Line.
+type Change struct {
+	Line     int
+	Old      string
+	New      string
+	Inserted bool
+}
+
+// Rewrite moves the `ref:` of every top-level include of the given project to ref.
+// Only the lines holding the refs are touched so comments and formatting of the
+// rest of the file stay as they are, includes without a `ref:` get one added
+// below their `project:`. Files with a `spec:` header keep their includes in the
+// second document, so every document of the file is searched.
+func Rewrite(file []byte, project, ref string) ([]byte, []Change, error) {
+	includes := make([]*yaml.Node, 0)
+	decoder := yaml.NewDecoder(bytes.NewReader(file))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, fmt.Errorf("failed to parse ci file: %w", err)
+		}
+
+		// The lines of the nodes count from the start of the file,
+		// not from the start of their document.
+		if len(document.Content) > 0 && document.Content[0].Kind == yaml.MappingNode {
+			includes = append(includes, includeMaps(document.Content[0])...)
+		}
+	}
+
+	if len(includes) == 0 {
+		return file, nil, nil
+	}
+
+	lines := strings.SplitAfter(string(file), "\n")
+	changes := make([]Change, 0)
+
+	for _, include := range includes {
+		projectKey, projectValue := mapEntry(include, "project")
+		if projectValue == nil || !strings.EqualFold(projectValue.Value, project) {
+			continue
+		}
+
+		if include.Style&yaml.FlowStyle != 0 {
+			return nil, nil, fmt.Errorf("line %d: %w", include.Line, ErrFlowStyleInclude)
+		}
+
+		_, refValue := mapEntry(include, "ref")
+		if refValue == nil {
+			indent := strings.Repeat(" ", projectKey.Column-1)
+			changes = append(changes, Change{
+				Line:     projectValue.Line,
+				New:      indent + "ref: " + ref,
+				Inserted: true,
+			})
+			continue
+		}
+
+		if refValue.Value == ref {
+			continue
+		}
+
+		old := strings.TrimSuffix(lines[refValue.Line-1], "\n")
+		updated, err := replaceScalar(old, refValue, ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", refValue.Line, err)
+		}
+
+		changes = append(changes, Change{Line: refValue.Line, Old: old, New: updated})
+	}
+
+	return apply(lines, changes), changes, nil
+}
+
+var ErrFlowStyleInclude = errors.New("includes written in flow style cannot be rewritten")
+
+// includeMaps returns the map form of all entries of the top-level `include:`.
+func includeMaps(root *yaml.Node) []*yaml.Node {
+	_, include := mapEntry(root, "include")
+	if include == nil {
+		return nil
+	}
+
+	switch include.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{include}
+	case yaml.SequenceNode:
+		maps := make([]*yaml.Node, 0, len(include.Content))
+		for _, i := range include.Content {
+			if i.Kind == yaml.MappingNode {
+				maps = append(maps, i)
+			}
+		}
+		return maps
+	default:
+		return nil
+	}
+}
+
+// mapEntry returns the key and value node of key inside of a mapping node.
+func mapEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// replaceScalar swaps the scalar node on line for value, quoted scalars keep their quotes.
+func replaceScalar(line string, node *yaml.Node, value string) (string, error) {
+	runes := []rune(line)
+	start := node.Column - 1
+	if start < 0 || start >= len(runes) {
+		return "", errors.New("ref is not where the parser found it")
+	}
+
+	end := start + len([]rune(node.Value))
+	switch node.Style {
+	case yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle:
+		quote := runes[start]
+		end = -1
+		for i := start + 1; i < len(runes); i++ {
+			if runes[i] == quote {
+				end = i + 1
+				break
+			}
+		}
+		if end < 0 {
+			return "", errors.New("multi-line refs cannot be rewritten")
+		}
+		value = string(quote) + value + string(quote)
+	case 0:
+	default:
+		return "", errors.New("multi-line refs cannot be rewritten")
+	}
+
+	if end > len(runes) {
+		return "", errors.New("multi-line refs cannot be rewritten")
+	}
+
+	return string(runes[:start]) + value + string(runes[end:]), nil
+}
+
+// apply writes the changes into the lines of the original file.
+func apply(lines []string, changes []Change) []byte {
+	changed := make(map[int]Change, len(changes))
+	for _, c := range changes {
+		changed[c.Line] = c
+	}
+
+	var out bytes.Buffer
+	for i, l := range lines {
+		c, ok := changed[i+1]
+		if !ok {
+			out.WriteString(l)
+			continue
+		}
+
+		newline := ""
+		if strings.HasSuffix(l, "\n") {
+			newline = "\n"
+		}
+
+		if c.Inserted {
+			out.WriteString(strings.TrimSuffix(l, "\n") + "\n" + c.New + newline)
+			continue
+		}
+
+		out.WriteString(c.New + newline)
+	}
+
+	return out.Bytes()
+}
+
+// Diff renders the changes to a file as a unified diff without context lines.
+func Diff(path string, changes []Change) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+
+	offset := 0
+	for _, c := range changes {
+		if c.Inserted {
+			fmt.Fprintf(&b, "@@ -%d,0 +%d @@\n+%s\n", c.Line, c.Line+offset+1, c.New)
+			offset++
+			continue
+		}
+		fmt.Fprintf(&b, "@@ -%d +%d @@\n-%s\n+%s\n", c.Line, c.Line+offset, c.Old, c.New)
+	}
+
+	return b.String()
+}
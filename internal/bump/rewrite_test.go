@@ -0,0 +1,101 @@
+package bump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewrite(t *testing.T) {
+	file := `# shared templates
+include:
+  - project: platform/ci   # build templates
+    ref: v1.0.0
+    file: /build.yml
+  - project: 'platform/ci'
+    ref: "v1.2.0"
+    file:
+      - /test.yml
+  - project: platform/ci
+    file: /deploy.yml
+  - project: other/ci
+    ref: v1.0.0
+    file: /lint.yml
+  - local: /local.yml
+
+build:
+  script: make # keep me
+`
+
+	expected := `# shared templates
+include:
+  - project: platform/ci   # build templates
+    ref: v2.0.0
+    file: /build.yml
+  - project: 'platform/ci'
+    ref: "v2.0.0"
+    file:
+      - /test.yml
+  - project: platform/ci
+    ref: v2.0.0
+    file: /deploy.yml
+  - project: other/ci
+    ref: v1.0.0
+    file: /lint.yml
+  - local: /local.yml
+
+build:
+  script: make # keep me
+`
+
+	out, changes, err := Rewrite([]byte(file), "platform/ci", "v2.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+	assert.Equal(t, []Change{
+		{Line: 4, Old: "    ref: v1.0.0", New: "    ref: v2.0.0"},
+		{Line: 7, Old: `    ref: "v1.2.0"`, New: `    ref: "v2.0.0"`},
+		{Line: 10, New: "    ref: v2.0.0", Inserted: true},
+	}, changes)
+
+	assert.Equal(t, `--- a/.gitlab-ci.yml
++++ b/.gitlab-ci.yml
+@@ -4 +4 @@
+-    ref: v1.0.0
++    ref: v2.0.0
+@@ -7 +7 @@
+-    ref: "v1.2.0"
++    ref: "v2.0.0"
+@@ -10,0 +11 @@
++    ref: v2.0.0
+`, Diff(".gitlab-ci.yml", changes))
+}
+
+func TestRewriteSingleInclude(t *testing.T) {
+	out, changes, err := Rewrite([]byte("include:\n  project: platform/ci\n  ref: v1\n  file: /build.yml"), "platform/ci", "v2")
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "include:\n  project: platform/ci\n  ref: v2\n  file: /build.yml", string(out))
+}
+
+func TestRewriteSpecHeader(t *testing.T) {
+	file := "spec:\n  inputs:\n    stage:\n      default: test\n---\ninclude:\n  - project: platform/ci\n    ref: v1\n    file: /build.yml\n"
+
+	out, changes, err := Rewrite([]byte(file), "platform/ci", "v2")
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{{Line: 8, Old: "    ref: v1", New: "    ref: v2"}}, changes)
+	assert.Equal(t, "spec:\n  inputs:\n    stage:\n      default: test\n---\ninclude:\n  - project: platform/ci\n    ref: v2\n    file: /build.yml\n", string(out))
+}
+
+func TestRewriteUpToDate(t *testing.T) {
+	file := []byte("include:\n  - project: platform/ci\n    ref: v2\n")
+
+	out, changes, err := Rewrite(file, "platform/ci", "v2")
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, file, out)
+}
+
+func TestRewriteFlowStyle(t *testing.T) {
+	_, _, err := Rewrite([]byte("include: [{project: platform/ci, ref: v1, file: /build.yml}]\n"), "platform/ci", "v2")
+	assert.ErrorIs(t, err, ErrFlowStyleInclude)
+}
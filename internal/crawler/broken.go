@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// brokenReason tells why an include cannot be read, errors that do not
+// break the pipeline, like a GitLab API hiccup, have no reason.
+func brokenReason(err error) (string, bool) {
+	switch {
+	case errors.Is(err, gitlab.ErrProjectNotFound):
+		return storage.BrokenReasonProjectMissing, true
+	case errors.Is(err, gitlab.ErrProjectForbidden),
+		errors.Is(err, gitlab.ErrRawFileForbidden):
+		return storage.BrokenReasonForbidden, true
+	case errors.Is(err, gitlab.ErrRawFileNotFound):
+		return storage.BrokenReasonFileMissing, true
+	case errors.Is(err, gitlab.ErrRefNotFound):
+		return storage.BrokenReasonRefMissing, true
+	default:
+		return "", false
+	}
+}
+
+// handleBrokenInclude records that parent includes files of target at ref that
+// cannot be read because of err. The edge starts at the project whose pipeline
+// fails, which is not the project of parent if the include is nested.
+func (c *Crawler) handleBrokenInclude(ctx context.Context, parent ciFileSource, target, ref string, files []string, err error) error {
+	reason, ok := brokenReason(err)
+	if !ok {
+		return nil
+	}
+
+	// Whether the pipeline can read projects the token cannot see is unknown.
+	if (reason == storage.BrokenReasonProjectMissing || reason == storage.BrokenReasonForbidden) && !c.inScope(target) {
+		return nil
+	}
+
+	// GitLab answers with the same 404 for a missing file and a missing ref.
+	if reason == storage.BrokenReasonFileMissing && ref != "" {
+		if r, err := c.resolveRef(ctx, target, ref); err == nil && r.refType == RefTypeMissing {
+			reason = storage.BrokenReasonRefMissing
+		}
+	}
+
+	root := parent.pipelineRoot()
+	properties := map[string]interface{}{"reason": reason}
+	if parent.includedBy != nil {
+		_, properties["included_by"] = parent.fileNode()
+	}
+
+	c.logger.Warn().
+		Str("Project", root.name).
+		Str("Ref", root.ref).
+		Str("Target", target).
+		Str("Reason", reason).
+		Msg("pipeline has a broken include")
+
+	if err := c.storage.CreateBrokenIncludeEdge(ctx, storage.Edge{
+		SourceType:    storage.NodeTypeProject,
+		SourceProject: root.name,
+		SourceRef:     root.ref,
+		Pipeline:      parent.pipeline(),
+		TargetProject: target,
+		Ref:           ref,
+		Files:         files,
+		Properties:    properties,
+	}); err != nil {
+		return fmt.Errorf("failed to write broken include edge: %w", err)
+	}
+	return nil
+}
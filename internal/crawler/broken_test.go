@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenIncludeStorage keeps the broken include edges written by the crawler.
+type brokenIncludeStorage struct {
+	NilStorage
+	mu    sync.Mutex
+	edges []storage.Edge
+}
+
+func (s *brokenIncludeStorage) CreateBrokenIncludeEdge(ctx context.Context, edge storage.Edge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edges = append(s.edges, edge)
+	return nil
+}
+
+func TestCrawlerHandleProjectIncludeRecordsBrokenIncludes(t *testing.T) {
+	const sha = "1f0e2b9d4a6c7e5f1a2b3c4d5e6f7a8b9c0d8f3c"
+
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                           `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/tags/v1.0.0":    `{"name":"v1.0.0","commit":{"id":"` + sha + `"}}`,
+		"/api/v4/projects/2/repository/files/build.yml/raw@" + sha: "include:\n  - local: /lint.yml\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	store := &brokenIncludeStorage{}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	for _, include := range []RemoteInclude{
+		{Project: "platform/ci", Ref: "v1.0.0", Files: StringArray{"/build.yml"}},
+		{Project: "platform/ci", Ref: "v9.9.9", Files: StringArray{"/build.yml"}},
+		{Project: "gone/ci", Ref: "main", Files: StringArray{"/build.yml"}},
+	} {
+		err := crawler.handleProjectInclude(context.TODO(), source, include, make(map[string]struct{}))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []storage.Edge{
+		{
+			SourceType:    storage.NodeTypeProject,
+			SourceProject: "team/app",
+			SourceRef:     "main",
+			Pipeline:      "team/app@main",
+			TargetProject: "platform/ci",
+			Ref:           "v1.0.0",
+			Files:         []string{"/lint.yml"},
+			Properties: map[string]interface{}{
+				"reason":      storage.BrokenReasonFileMissing,
+				"included_by": storage.FileID("platform/ci", "/build.yml", "v1.0.0"),
+			},
+		},
+		{
+			SourceType:    storage.NodeTypeProject,
+			SourceProject: "team/app",
+			SourceRef:     "main",
+			Pipeline:      "team/app@main",
+			TargetProject: "platform/ci",
+			Ref:           "v9.9.9",
+			Files:         []string{"/build.yml"},
+			Properties:    map[string]interface{}{"reason": storage.BrokenReasonRefMissing},
+		},
+		{
+			SourceType:    storage.NodeTypeProject,
+			SourceProject: "team/app",
+			SourceRef:     "main",
+			Pipeline:      "team/app@main",
+			TargetProject: "gone/ci",
+			Ref:           "main",
+			Files:         []string{"/build.yml"},
+			Properties:    map[string]interface{}{"reason": storage.BrokenReasonProjectMissing},
+		},
+	}, store.edges)
+}
+
+func TestCrawlerChildPipelineContinuesAfterForbiddenFile(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                          `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/branches/main": `{"name":"main","commit":{"id":"abc"}}`,
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			if strings.Contains(key, "secret.yml") {
+				return &http.Response{
+					StatusCode: http.StatusForbidden,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"403 Forbidden"}`)),
+				}, nil
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	store := &brokenIncludeStorage{}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	// The forbidden file does not keep the child pipeline's other files from being followed.
+	include := RemoteInclude{Project: "platform/ci", Ref: "main", Files: StringArray{"/secret.yml", "/lint.yml"}}
+	edge := storage.Edge{SourceType: storage.NodeTypeFile, Pipeline: source.pipeline()}
+	assert.NoError(t, crawler.handleChildPipelineProjectInclude(context.TODO(), source, include, edge, source.jobs, make(map[string]struct{})))
+
+	reasons := make(map[string]string)
+	for _, e := range store.edges {
+		reasons[e.Files[0]] = e.Properties["reason"].(string)
+	}
+	assert.Equal(t, map[string]string{
+		"/secret.yml": storage.BrokenReasonForbidden,
+		"/lint.yml":   storage.BrokenReasonFileMissing,
+	}, reasons)
+	assert.Len(t, crawler.failures.report(time.Time{}).Failures, 2)
+}
+
+// childPipelineStorage keeps the File nodes and child pipeline edges written by the crawler.
+type childPipelineStorage struct {
+	brokenIncludeStorage
+	files      map[string]struct{}
+	childEdges []storage.Edge
+}
+
+func (s *childPipelineStorage) CreateFileNode(ctx context.Context, file storage.File) error {
+	s.files[storage.FileID(file.Project, file.Path, file.Ref)] = struct{}{}
+	return nil
+}
+
+func (s *childPipelineStorage) CreateChildPipelineEdge(ctx context.Context, edge storage.Edge) error {
+	s.childEdges = append(s.childEdges, edge)
+	return nil
+}
+
+func TestCrawlerChildPipelineKeepsEdgesOfBrokenFiles(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                          `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/branches/main": `{"name":"main","commit":{"id":"abc"}}`,
+		"/api/v4/projects/2/repository/files/broken.yml/raw@abc":  "build: [\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	store := &childPipelineStorage{files: make(map[string]struct{})}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	include := RemoteInclude{Project: "platform/ci", Ref: "main", Files: StringArray{"/missing.yml", "broken.yml"}}
+	edge := storage.Edge{SourceType: storage.NodeTypeFile, Pipeline: source.pipeline()}
+	assert.NoError(t, crawler.handleChildPipelineProjectInclude(context.TODO(), source, include, edge, source.jobs, make(map[string]struct{})))
+
+	// Both files keep their edge, and every edge points to a File node.
+	targets := make([]string, 0)
+	for _, e := range store.childEdges {
+		assert.Contains(t, store.files, e.TargetProject)
+		targets = append(targets, e.TargetProject)
+	}
+	assert.Equal(t, []string{
+		storage.FileID("platform/ci", "/missing.yml", "main"),
+		storage.FileID("platform/ci", "broken.yml", "main"),
+	}, targets)
+
+	assert.Len(t, store.edges, 1)
+	assert.Equal(t, []string{"/missing.yml"}, store.edges[0].Files)
+	assert.Len(t, crawler.failures.report(time.Time{}).Failures, 2)
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+// checkpoint is where an interrupted crawl continues. Projects are streamed in
+// ascending order of their ID, one group after the other for group-scoped crawls,
+// so everything before PageURL and every project of that page up to LastProjectID
+// has been written to the storage already.
+type checkpoint struct {
+	PageURL       string    `json:"page_url"`
+	LastProjectID int       `json:"last_project_id"`
+	StartedAt     time.Time `json:"started_at"`
+}
+
+func loadCheckpoint(path string) (checkpoint, error) {
+	var cp checkpoint
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cp, fmt.Errorf("no checkpoint to resume from at %s", path)
+		}
+		return cp, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return cp, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+
+	return cp, nil
+}
+
+func (cp checkpoint) save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// progressTracker follows the pages of the project stream until every project
+// of them was handled by a worker. Workers finish projects out of order, the
+// checkpoint only moves past a project once all projects before it are done,
+// so projects still in flight when the crawl dies are crawled again on resume.
+type progressTracker struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	// pages holds the pages with unfinished projects in stream order.
+	pages []*trackedPage
+	// last is the most recent checkpoint, it is kept once all pages are done.
+	last checkpoint
+}
+
+type trackedPage struct {
+	url      string
+	projects []int
+	done     map[int]struct{}
+}
+
+func newProgressTracker(from checkpoint) *progressTracker {
+	return &progressTracker{startedAt: from.StartedAt, last: from}
+}
+
+// page registers a page of the stream before its projects are handed out.
+func (pt *progressTracker) page(pageURL string, projects []gitlab.Project) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	ids := make([]int, 0, len(projects))
+	for _, p := range projects {
+		ids = append(ids, p.ID)
+	}
+
+	pt.pages = append(pt.pages, &trackedPage{
+		url:      pageURL,
+		projects: ids,
+		done:     make(map[int]struct{}),
+	})
+}
+
+// done marks a project as written to the storage.
+func (pt *progressTracker) done(projectID int) {
+	if pt == nil {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	for _, p := range pt.pages {
+		for _, id := range p.projects {
+			if id == projectID {
+				p.done[projectID] = struct{}{}
+			}
+		}
+	}
+
+	for len(pt.pages) > 0 && len(pt.pages[0].done) == len(pt.pages[0].projects) {
+		finished := pt.pages[0]
+		pt.pages = pt.pages[1:]
+
+		pt.last = checkpoint{PageURL: finished.url, StartedAt: pt.startedAt}
+		if n := len(finished.projects); n > 0 {
+			pt.last.LastProjectID = finished.projects[n-1]
+		}
+	}
+}
+
+// checkpoint returns the position the crawl can continue at.
+func (pt *progressTracker) checkpoint() checkpoint {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if len(pt.pages) == 0 {
+		return pt.last
+	}
+
+	first := pt.pages[0]
+	cp := checkpoint{PageURL: first.url, StartedAt: pt.startedAt}
+	for _, id := range first.projects {
+		if _, ok := first.done[id]; !ok {
+			break
+		}
+		cp.LastProjectID = id
+	}
+
+	return cp
+}
+
+// writeCheckpoints saves the progress every interval until ctx is done and
+// once more when it is, so a crawl that fails leaves its latest position behind.
+func (c *Crawler) writeCheckpoints(ctx context.Context, tracker *progressTracker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.saveCheckpoint(tracker)
+			return
+		case <-ticker.C:
+			c.saveCheckpoint(tracker)
+		}
+	}
+}
+
+func (c *Crawler) saveCheckpoint(tracker *progressTracker) {
+	cp := tracker.checkpoint()
+	if cp.PageURL == "" {
+		return
+	}
+
+	if err := cp.save(c.config.CheckpointFile); err != nil {
+		c.logger.Err(err).Msg("failed to save checkpoint")
+		return
+	}
+
+	c.logger.Debug().
+		Str("PageURL", cp.PageURL).
+		Int("LastProjectID", cp.LastProjectID).
+		Msg("saved checkpoint")
+}
@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressTracker(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newProgressTracker(checkpoint{StartedAt: started})
+
+	tracker.page("page-1", []gitlab.Project{{ID: 1}, {ID: 2}, {ID: 3}})
+	tracker.page("page-2", []gitlab.Project{{ID: 4}, {ID: 5}})
+
+	assert.Equal(t, checkpoint{PageURL: "page-1", StartedAt: started}, tracker.checkpoint())
+
+	// Project 2 is still in flight, so the checkpoint may not move past it.
+	tracker.done(1)
+	tracker.done(3)
+	tracker.done(4)
+	assert.Equal(t, checkpoint{PageURL: "page-1", LastProjectID: 1, StartedAt: started}, tracker.checkpoint())
+
+	tracker.done(2)
+	assert.Equal(t, checkpoint{PageURL: "page-2", LastProjectID: 4, StartedAt: started}, tracker.checkpoint())
+
+	tracker.done(5)
+	assert.Equal(t, checkpoint{PageURL: "page-2", LastProjectID: 5, StartedAt: started}, tracker.checkpoint())
+}
+
+func TestCheckpointSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	_, err := loadCheckpoint(path)
+	assert.Error(t, err)
+
+	cp := checkpoint{
+		PageURL:       "https://gitlab.example.com/api/v4/projects?id_after=42&order_by=id&pagination=keyset&per_page=100&sort=asc",
+		LastProjectID: 57,
+		StartedAt:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	assert.NoError(t, cp.save(path))
+
+	loaded, err := loadCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, cp, loaded)
+}
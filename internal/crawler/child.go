@@ -0,0 +1,223 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// childPipelineCycleKey prefixes the keys of child pipeline configurations in the
+// cycle detection map, they are the only keys a child pipeline inherits.
+const childPipelineCycleKey = "child--"
+
+// handleChildPipeline records the child pipeline started by a trigger and follows
+// the files making up its configuration. GitLab merges all includes of a trigger
+// into one pipeline that is independent of its parent, so the jobs of the child
+// are collected and resolved on their own.
+func (c *Crawler) handleChildPipeline(ctx context.Context, parent ciFileSource, trigger RawTrigger, cycleDetectionMap map[string]struct{}) error {
+	// A child pipeline is free to include the same files as its parent, only
+	// a child pipeline triggering one of its ancestors is a cycle.
+	childCycleDetectionMap := make(map[string]struct{})
+	for k := range cycleDetectionMap {
+		if strings.HasPrefix(k, childPipelineCycleKey) {
+			childCycleDetectionMap[k] = struct{}{}
+		}
+	}
+
+	jobs := &jobIndex{}
+	for _, include := range trigger.Includes {
+		if err := c.handleChildPipelineInclude(ctx, parent, trigger, include, jobs, childCycleDetectionMap); err != nil {
+			c.logger.Err(err).
+				Str("Source", parent.name).
+				Str("Job", trigger.Job).
+				Msg("failed to handle child pipeline include")
+			c.recordFailure(parent, err)
+		}
+	}
+
+	return c.storeJobs(ctx, parent.pipeline(), jobs)
+}
+
+// handleChildPipelineInclude stores the CHILD_PIPELINE edge for a single include
+// of a trigger and recurses into the included file.
+func (c *Crawler) handleChildPipelineInclude(ctx context.Context, parent ciFileSource, trigger RawTrigger, include RemoteInclude, jobs *jobIndex, cycleDetectionMap map[string]struct{}) error {
+	properties := include.edgeProperties()
+	for k, v := range trigger.edgeProperties() {
+		properties[k] = v
+	}
+
+	edge := storage.Edge{
+		SourceType:    parent.nodeType,
+		SourceProject: parent.name,
+		SourceRef:     parent.ref,
+		Pipeline:      parent.pipeline(),
+		Ref:           include.Ref,
+		Files:         include.Files,
+		Unresolved:    include.Unresolved,
+		Properties:    properties,
+	}
+
+	switch {
+	case include.Artifact != "":
+		_, fileID := parent.fileNode()
+		pipeline := storage.DynamicPipeline{
+			FileID:   fileID,
+			Job:      include.Job,
+			Artifact: include.Artifact,
+		}
+
+		if err := c.storage.CreateDynamicPipelineNode(ctx, pipeline); err != nil {
+			return fmt.Errorf("failed to write dynamic pipeline to storage: %w", err)
+		}
+
+		edge.TargetType = storage.NodeTypeDynamicPipeline
+		edge.TargetProject = storage.DynamicPipelineID(pipeline.FileID, pipeline.Job, pipeline.Artifact)
+		return c.createChildPipelineEdge(ctx, edge)
+	case include.Remote != "":
+		if err := c.storage.CreateRemoteFileNode(ctx, include.Remote); err != nil {
+			return fmt.Errorf("failed to write remote file to storage: %w", err)
+		}
+
+		edge.TargetType = storage.NodeTypeRemoteFile
+		edge.TargetProject = include.Remote
+		if err := c.createChildPipelineEdge(ctx, edge); err != nil || include.Unresolved {
+			return err
+		}
+
+		child := parent.include(ciFileSource{
+			nodeType: storage.NodeTypeRemoteFile,
+			name:     include.Remote,
+		}, include)
+		child.jobs = jobs
+
+		leave, err := detectCycle(cycleDetectionMap, childPipelineCycleKey+include.Remote)
+		if err != nil {
+			return inFile(child, err)
+		}
+		defer leave()
+		return c.followRemoteFile(ctx, child, cycleDetectionMap)
+	case include.Template != "":
+		if err := c.storage.CreateTemplateNode(ctx, include.Template); err != nil {
+			return fmt.Errorf("failed to write template to storage: %w", err)
+		}
+
+		edge.TargetType = storage.NodeTypeTemplate
+		edge.TargetProject = include.Template
+		if err := c.createChildPipelineEdge(ctx, edge); err != nil || include.Unresolved {
+			return err
+		}
+
+		child := parent.include(ciFileSource{
+			nodeType: storage.NodeTypeTemplate,
+			name:     include.Template,
+		}, include)
+		child.jobs = jobs
+
+		leave, err := detectCycle(cycleDetectionMap, childPipelineCycleKey+include.Template)
+		if err != nil {
+			return inFile(child, err)
+		}
+		defer leave()
+		return c.followTemplate(ctx, child, cycleDetectionMap)
+	case include.Project != "":
+		return c.handleChildPipelineProjectInclude(ctx, parent, include, edge, jobs, cycleDetectionMap)
+	default:
+		// Local includes were turned into project includes by enrichTriggers,
+		// what is left are components. They are only followed when included
+		// by a CI file, a child pipeline made of components is not recorded.
+		c.logger.Debug().
+			Str("Source", parent.name).
+			Str("Job", trigger.Job).
+			Str("Local", include.Local).
+			Str("Component", include.Component).
+			Msg("skipping child pipeline include that cannot be resolved to a file")
+		return nil
+	}
+}
+
+// handleChildPipelineProjectInclude follows the files of a child pipeline that
+// live inside of a project, local files included. The File node is written
+// before the edge, so files that cannot be read or parsed keep their edge.
+func (c *Crawler) handleChildPipelineProjectInclude(ctx context.Context, parent ciFileSource, include RemoteInclude, edge storage.Edge, jobs *jobIndex, cycleDetectionMap map[string]struct{}) error {
+	edge.TargetType = storage.NodeTypeFile
+	edge.Properties = c.refProperties(ctx, edge.Properties, include.Project, include.Ref, include.Unresolved)
+
+	if include.Unresolved {
+		return c.createChildPipelineFileEdges(ctx, include.Project, include.Files, include.Ref, edge)
+	}
+
+	project := parent.project
+	if include.Project != project.PathWithNamespace {
+		p, err := c.getProject(ctx, include.Project)
+		if err != nil {
+			if err := c.handleBrokenInclude(ctx, parent, include.Project, include.Ref, include.Files, err); err != nil {
+				return err
+			}
+			if err := c.handleMissingProject(ctx, include.Project, err); err != nil {
+				return err
+			}
+			return c.createChildPipelineFileEdges(ctx, include.Project, include.Files, include.Ref, edge)
+		}
+		project = p
+	}
+
+	ref := fileRef(include, project)
+	if include.Local != "" {
+		c.state.markLocalInclude(parent.pipelineRoot().project.ID)
+	}
+
+	if err := c.createChildPipelineFileEdges(ctx, project.PathWithNamespace, include.Files, ref, edge); err != nil {
+		return err
+	}
+
+	// Files that cannot be read are recorded as broken includes by
+	// handleIncludes, a failing file does not stop the other files.
+	for _, f := range include.Files {
+		child := parent.include(projectSource(project, f, nil), include)
+		child.jobs = jobs
+		child.ref = ref
+
+		leave, err := detectCycle(cycleDetectionMap, childPipelineCycleKey+storage.FileID(project.PathWithNamespace, f, ref))
+		if err != nil {
+			c.recordFailure(child, err)
+			continue
+		}
+		err = c.handleIncludes(ctx, child, cycleDetectionMap)
+		leave()
+		if err != nil {
+			c.logger.Err(err).
+				Str("Project", project.PathWithNamespace).
+				Str("File", f).
+				Msg("failed to handle child pipeline file")
+			c.recordFailure(child, err)
+		}
+	}
+
+	return nil
+}
+
+// createChildPipelineFileEdges writes the File nodes of a child pipeline and
+// the CHILD_PIPELINE edges pointing to them. Files that are read later on
+// fill in their inputs when they are parsed.
+func (c *Crawler) createChildPipelineFileEdges(ctx context.Context, project string, files []string, ref string, edge storage.Edge) error {
+	for _, f := range files {
+		if err := c.storage.CreateFileNode(ctx, storage.File{Project: project, Path: f, Ref: ref}); err != nil {
+			return fmt.Errorf("failed to write file to storage: %w", err)
+		}
+
+		edge.TargetProject = storage.FileID(project, f, ref)
+		if err := c.createChildPipelineEdge(ctx, edge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Crawler) createChildPipelineEdge(ctx context.Context, edge storage.Edge) error {
+	if err := c.storage.CreateChildPipelineEdge(ctx, edge); err != nil {
+		return fmt.Errorf("failed to write child pipeline edge: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/semver"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// ComponentReference is a parsed `include:component` value of the form
+// <fqdn>/<project path>/<component name>@<version>, see
+// https://docs.gitlab.com/ee/ci/components/#use-a-component
+type ComponentReference struct {
+	Host    string
+	Project string
+	Name    string
+	// Version is kept as requested by the consumer, it can be a full
+	// or partial semantic version, `~latest`, a branch or a commit SHA.
+	Version string
+}
+
+func parseComponentReference(ref string) (ComponentReference, error) {
+	path, version, found := strings.Cut(ref, "@")
+	if !found || version == "" {
+		return ComponentReference{}, fmt.Errorf("component %q is missing a version", ref)
+	}
+
+	elems := strings.Split(strings.Trim(path, "/"), "/")
+	// the smallest valid reference is <fqdn>/<namespace>/<project>/<component name>
+	if len(elems) < 4 {
+		return ComponentReference{}, fmt.Errorf("component %q is not of the form <fqdn>/<project path>/<component name>@<version>", ref)
+	}
+
+	return ComponentReference{
+		Host:    elems[0],
+		Project: strings.Join(elems[1:len(elems)-1], "/"),
+		Name:    elems[len(elems)-1],
+		Version: version,
+	}, nil
+}
+
+// TemplateFiles returns the files a component can be defined in, in the
+// order GitLab looks them up.
+func (cr ComponentReference) TemplateFiles() []string {
+	return []string{
+		"templates/" + cr.Name + ".yml",
+		"templates/" + cr.Name + "/template.yml",
+	}
+}
+
+// isGitLabHost reports whether a host taken from a CI file points to the
+// GitLab instance that is being crawled.
+func (c *Crawler) isGitLabHost(host string) bool {
+	u, err := url.Parse(c.config.GitlabHost)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname())
+}
+
+// partialVersion matches the versions GitLab resolves to the latest release
+// with the same major or major and minor version.
+var partialVersion = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// isRef reports whether the version of the component is a plain git ref,
+// `~latest` and partial versions are resolved against the project's releases.
+func (cr ComponentReference) isRef() bool {
+	return cr.Version != "~latest" && !partialVersion.MatchString(cr.Version)
+}
+
+// handleComponentInclude resolves a component to the file backing it inside
+// its project, records the include and follows the component's file.
+func (c *Crawler) handleComponentInclude(ctx context.Context, parent ciFileSource, include RemoteInclude, cycleDetectionMap map[string]struct{}) error {
+	rawComponent := include.Component
+	component, err := parseComponentReference(rawComponent)
+	if err != nil {
+		return err
+	}
+
+	if include.Unresolved {
+		targetType, err := c.createProjectTarget(ctx, component.Project)
+		if err != nil {
+			return err
+		}
+
+		return c.storage.CreateComponentIncludeEdge(ctx, storage.Edge{
+			SourceType:    parent.nodeType,
+			SourceProject: parent.name,
+			SourceRef:     parent.ref,
+			Pipeline:      parent.pipeline(),
+			TargetType:    targetType,
+			TargetProject: component.Project,
+			Ref:           component.Version,
+			Component:     component.Name,
+			Unresolved:    true,
+			Properties:    include.edgeProperties(),
+		})
+	}
+
+	if !c.isGitLabHost(component.Host) {
+		c.logger.Warn().
+			Str("Component", rawComponent).
+			Str("Source", parent.name).
+			Msg("skipping component hosted on a different GitLab instance")
+		return nil
+	}
+
+	p, err := c.getProject(ctx, component.Project)
+	if err != nil {
+		if err := c.handleBrokenInclude(ctx, parent, component.Project, component.Version, nil, err); err != nil {
+			return err
+		}
+		if err := c.handleMissingProject(ctx, component.Project, err); err != nil {
+			return err
+		}
+
+		return c.storage.CreateComponentIncludeEdge(ctx, storage.Edge{
+			SourceType:    parent.nodeType,
+			SourceProject: parent.name,
+			SourceRef:     parent.ref,
+			Pipeline:      parent.pipeline(),
+			TargetProject: component.Project,
+			Ref:           component.Version,
+			Component:     component.Name,
+			Properties:    include.edgeProperties(),
+		})
+	}
+
+	// Versions like `~latest` or `1.2` are resolved by GitLab against the
+	// releases of the project, everything else is a plain git ref.
+	ref := component.Version
+	var release resolvedRef
+	if !component.isRef() {
+		release, err = c.resolveComponentVersion(ctx, p, component.Version)
+		if err != nil {
+			return fmt.Errorf("failed to resolve version %s of component %s: %w", component.Version, rawComponent, err)
+		}
+		ref = release.name
+	}
+
+	var source ciFileSource
+	var componentFile []byte
+	var componentFilePath string
+	if release.refType != RefTypeMissing {
+		for _, f := range component.TemplateFiles() {
+			source = parent.include(projectSource(p, f, nil), include)
+			source.ref = ref
+
+			componentFile, err = c.getProjectFile(ctx, source)
+			if err != nil {
+				if errors.Is(err, gitlab.ErrRawFileNotFound) {
+					continue
+				}
+				return inFile(source, fmt.Errorf("failed to get component file %s: %w", f, err))
+			}
+			componentFilePath = f
+			break
+		}
+	}
+
+	if err := c.storage.CreateProjectNode(ctx, component.Project); err != nil {
+		return fmt.Errorf("failed to write project to storage: %w", err)
+	}
+
+	edge := storage.Edge{
+		SourceType:    parent.nodeType,
+		SourceProject: parent.name,
+		SourceRef:     parent.ref,
+		Pipeline:      parent.pipeline(),
+		TargetProject: component.Project,
+		Ref:           component.Version,
+		Component:     component.Name,
+		Properties:    include.edgeProperties(),
+	}
+	if component.isRef() {
+		edge.Properties = c.refProperties(ctx, edge.Properties, component.Project, component.Version, false)
+	} else if release.sha != "" {
+		edge.Properties["sha"] = release.sha
+		edge.Properties["ref_type"] = release.refType
+	}
+	if componentFilePath != "" {
+		edge.Files = []string{componentFilePath}
+	}
+
+	if err := c.storage.CreateComponentIncludeEdge(ctx, edge); err != nil {
+		return fmt.Errorf("failed to write component include edge: %w", err)
+	}
+
+	if componentFilePath == "" {
+		c.logger.Warn().
+			Str("Component", rawComponent).
+			Str("Source", parent.name).
+			Msg("could not find the template file of the component")
+		if release.refType == RefTypeMissing {
+			return c.handleBrokenInclude(ctx, parent, component.Project, component.Version, component.TemplateFiles(), gitlab.ErrRefNotFound)
+		}
+		return c.handleBrokenInclude(ctx, parent, component.Project, ref, component.TemplateFiles(), gitlab.ErrRawFileNotFound)
+	}
+
+	leave, err := detectCycle(cycleDetectionMap, p.PathWithNamespace+"--"+componentFilePath+"@"+ref)
+	if err != nil {
+		return inFile(source, err)
+	}
+	defer leave()
+
+	return inFile(source, c.handleCIFile(ctx, source, componentFile, cycleDetectionMap))
+}
+
+// resolveComponentVersion finds the release GitLab uses for `~latest` or a
+// partial version of a component, the highest version tag that is no
+// pre-release and, for partial versions, has the same major or major and
+// minor version. Components without such a release resolve to a missing ref.
+func (c *Crawler) resolveComponentVersion(ctx context.Context, p gitlab.Project, version string) (resolvedRef, error) {
+	key := "release:" + p.PathWithNamespace + "@" + version
+	if r, ok := c.refCache.get(key); ok {
+		return r, nil
+	}
+
+	tags, err := c.gitlabClient.ListTags(ctx, p.ID)
+	if err != nil {
+		return resolvedRef{}, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	r := resolvedRef{refType: RefTypeMissing}
+	var latest semver.Version
+	for _, t := range tags {
+		v, ok := semver.Parse(t.Name)
+		if !ok || v.Prerelease != "" {
+			continue
+		}
+		if version != "~latest" && !v.Matches(version) {
+			continue
+		}
+		if r.name == "" || v.Compare(latest) > 0 {
+			r = resolvedRef{name: t.Name, sha: t.Commit.ID, refType: RefTypeTag}
+			latest = v
+		}
+	}
+
+	c.refCache.set(key, r)
+	return r, nil
+}
@@ -0,0 +1,206 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseComponentReference(t *testing.T) {
+	testData := []struct {
+		Name    string
+		In      string
+		Out     ComponentReference
+		WantErr bool
+	}{
+		{
+			Name: "ExactVersion",
+			In:   "gitlab.example.com/group/components/sast@1.2.0",
+			Out:  ComponentReference{Host: "gitlab.example.com", Project: "group/components", Name: "sast", Version: "1.2.0"},
+		},
+		{
+			Name: "LatestInSubgroup",
+			In:   "$CI_SERVER_FQDN/group/sub/components/build@~latest",
+			Out:  ComponentReference{Host: "$CI_SERVER_FQDN", Project: "group/sub/components", Name: "build", Version: "~latest"},
+		},
+		{
+			Name: "PartialSemver",
+			In:   "gitlab.example.com:8443/group/components/sast@1",
+			Out:  ComponentReference{Host: "gitlab.example.com:8443", Project: "group/components", Name: "sast", Version: "1"},
+		},
+		{
+			Name:    "MissingVersion",
+			In:      "gitlab.example.com/group/components/sast",
+			WantErr: true,
+		},
+		{
+			Name:    "MissingProject",
+			In:      "gitlab.example.com/components/sast@1.0.0",
+			WantErr: true,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			cr, err := parseComponentReference(td.In)
+			if td.WantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, td.Out, cr)
+			assert.Equal(t, []string{"templates/" + td.Out.Name + ".yml", "templates/" + td.Out.Name + "/template.yml"}, cr.TemplateFiles())
+		})
+	}
+}
+
+// componentIncludeStorage keeps the component include edges written by the crawler.
+type componentIncludeStorage struct {
+	NilStorage
+	mu    sync.Mutex
+	edges []storage.Edge
+}
+
+func (s *componentIncludeStorage) CreateComponentIncludeEdge(ctx context.Context, edge storage.Edge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edges = append(s.edges, edge)
+	return nil
+}
+
+func TestCrawlerHandleComponentIncludeResolvesReleases(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fcomponents": `{"id":3,"default_branch":"main","path_with_namespace":"platform/components"}`,
+		"/api/v4/projects/3/repository/tags": `[
+			{"name":"2.1.0-rc.1","commit":{"id":"rc"}},
+			{"name":"2.0.0","commit":{"id":"two"}},
+			{"name":"1.3.0","commit":{"id":"onethree"}},
+			{"name":"1.2.5","commit":{"id":"onetwo"}}
+		]`,
+		"/api/v4/projects/platform%2Fcomponents/repository/tags/2.0.0":          `{"name":"2.0.0","commit":{"id":"two"}}`,
+		"/api/v4/projects/platform%2Fcomponents/repository/tags/1.3.0":          `{"name":"1.3.0","commit":{"id":"onethree"}}`,
+		"/api/v4/projects/3/repository/files/templates%2Fsast.yml/raw@two":      "sast-v2:\n  script: [echo]\n",
+		"/api/v4/projects/3/repository/files/templates%2Fsast.yml/raw@onethree": "sast-v1:\n  script: [echo]\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	store := &componentIncludeStorage{}
+	crawler, err := New(&Config{GitlabHost: "https://gitlab.example.com"}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	testData := []struct {
+		Version string
+		SHA     interface{}
+		Job     string
+	}{
+		{Version: "~latest", SHA: "two", Job: "sast-v2"},
+		{Version: "1", SHA: "onethree", Job: "sast-v1"},
+		{Version: "1.2", SHA: "onetwo"},
+		{Version: "3"},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Version, func(t *testing.T) {
+			store.edges = nil
+			source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+			source.jobs = &jobIndex{}
+
+			include := RemoteInclude{Component: "gitlab.example.com/platform/components/sast@" + td.Version}
+			assert.NoError(t, crawler.handleComponentInclude(context.TODO(), source, include, make(map[string]struct{})))
+
+			assert.Len(t, store.edges, 1)
+			assert.Equal(t, td.Version, store.edges[0].Ref)
+			assert.Equal(t, td.SHA, store.edges[0].Properties["sha"])
+
+			jobs := make([]string, 0)
+			for _, d := range source.jobs.definitions {
+				jobs = append(jobs, d.job.Name)
+			}
+			if td.Job != "" {
+				assert.Equal(t, []string{td.Job}, jobs)
+			} else {
+				assert.Empty(t, jobs)
+			}
+		})
+	}
+}
+
+func TestCrawlerComponentCycleIsReportedInItsFile(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fcomponents":                           `{"id":3,"default_branch":"main","path_with_namespace":"platform/components"}`,
+		"/api/v4/projects/platform%2Fcomponents/repository/tags/1.0.0":     `{"name":"1.0.0","commit":{"id":"one"}}`,
+		"/api/v4/projects/3/repository/files/templates%2Fsast.yml/raw@one": "include:\n  - local: /rules.yml\n",
+		"/api/v4/projects/3/repository/files/rules.yml/raw@one":            "include:\n  - component: gitlab.example.com/platform/components/sast@1.0.0\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{GitlabHost: "https://gitlab.example.com"}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	ciFile := []byte("include:\n  - component: gitlab.example.com/platform/components/sast@1.0.0\n")
+	assert.NoError(t, crawler.handleCIFile(context.TODO(), source, ciFile, make(map[string]struct{})))
+
+	report := crawler.failures.report(time.Time{})
+	assert.Len(t, report.Failures, 1)
+	assert.Equal(t, FailureClassCycle, report.Failures[0].Class)
+	assert.Equal(t, "templates/sast.yml", report.Failures[0].File)
+	assert.Equal(t, "1.0.0", report.Failures[0].Ref)
+}
@@ -45,6 +45,72 @@ type Config struct {
 	HTTPClientMaxRetryWait time.Duration `conf:"default:30s,short:w,env:HTTP_CLIENT_MAX_RETRY_WAIT"`
 	HTTPClientMinRetryWait time.Duration `conf:"default:5s,short:n,env:HTTP_CLIENT_MIN_RETRY_WAIT"`
 	NumberOfWorkers        int           `conf:"default:20,short:c,env:NUMBER_OF_WORKERS"`
+	// RemoteIncludeAllowedHosts lists the hosts `include:remote` files are downloaded
+	// from, remote includes pointing anywhere else are only recorded in the graph.
+	RemoteIncludeAllowedHosts []string `conf:"env:REMOTE_INCLUDE_ALLOWED_HOSTS"`
+	RemoteIncludeMaxSize      int64    `conf:"default:1048576,env:REMOTE_INCLUDE_MAX_SIZE"`
+	// FollowBuiltinTemplates fetches GitLab's built-in templates through the
+	// templates API so includes nested inside them end up in the graph.
+	FollowBuiltinTemplates bool `conf:"default:false,env:FOLLOW_BUILTIN_TEMPLATES"`
+	// ResolveCIVariables reads the CI/CD variables of projects and their groups to
+	// expand variables in includes, this needs the maintainer role on the projects.
+	ResolveCIVariables bool `conf:"default:false,env:RESOLVE_CI_VARIABLES"`
+	// RefSelection picks the refs of every project whose pipeline is crawled:
+	// `default` only crawls the default branch, `protected` all protected branches,
+	// `tags` all tags matching RefTagPattern and `recent-tags` the RefRecentTags
+	// most recently updated tags matching it.
+	RefSelection  string `conf:"default:default,env:REF_SELECTION"`
+	RefTagPattern string `conf:"default:.*,env:REF_TAG_PATTERN"`
+	RefRecentTags int    `conf:"default:5,env:REF_RECENT_TAGS"`
+	// Groups limits the crawl to the projects of these groups and their
+	// subgroups, given by ID or full path. Includes of projects outside of
+	// them are still recorded, so a group access token is enough to crawl.
+	Groups []string `conf:"env:GROUPS"`
+	// ProjectInclude and ProjectExclude select the crawled projects by their path
+	// with namespace. Patterns are globs where `*` matches within a group and `**`
+	// across groups, patterns enclosed in slashes are regular expressions.
+	ProjectInclude []string `conf:"env:PROJECT_INCLUDE"`
+	ProjectExclude []string `conf:"env:PROJECT_EXCLUDE"`
+	// ProjectTopics only crawls projects having all of the topics while
+	// ProjectExcludeTopics skips projects having any of them.
+	ProjectTopics        []string `conf:"env:PROJECT_TOPICS"`
+	ProjectExcludeTopics []string `conf:"env:PROJECT_EXCLUDE_TOPICS"`
+	// ProjectVisibility lists the visibilities of the crawled projects,
+	// `public`, `internal` or `private`, all are crawled if it is empty.
+	ProjectVisibility   []string `conf:"env:PROJECT_VISIBILITY"`
+	ProjectSkipArchived bool     `conf:"default:false,env:PROJECT_SKIP_ARCHIVED"`
+	// ProjectForks is `include`, `exclude` or `exclude-personal` to only skip
+	// forks in user namespaces.
+	ProjectForks string `conf:"default:include,env:PROJECT_FORKS"`
+	// ProjectMembership and ProjectOwned limit the crawl to the projects the
+	// user of the token is a member or the owner of.
+	ProjectMembership bool `conf:"default:false,env:PROJECT_MEMBERSHIP"`
+	ProjectOwned      bool `conf:"default:false,env:PROJECT_OWNED"`
+	// StateFile turns on incremental crawling, the state of every crawl is stored
+	// in it and the next crawl only visits projects that changed since. Unlike
+	// StorageCleanup the graph is kept and only the changed projects are rewritten.
+	StateFile string `conf:"env:STATE_FILE"`
+	// CheckpointFile keeps the position of the crawl every CheckpointInterval, an
+	// interrupted crawl continues from it with Resume instead of starting over.
+	CheckpointFile     string        `conf:"env:CHECKPOINT_FILE"`
+	CheckpointInterval time.Duration `conf:"default:1m,env:CHECKPOINT_INTERVAL"`
+	Resume             bool          `conf:"default:false,env:RESUME"`
+	// FailureReportFile receives a JSON report of everything that failed during
+	// a crawl. If more than MaxFailedProjects projects failed the crawl exits
+	// with an error, a negative value never fails the crawl.
+	FailureReportFile string `conf:"env:FAILURE_REPORT_FILE"`
+	MaxFailedProjects int    `conf:"default:-1,env:MAX_FAILED_PROJECTS"`
+	// FileCacheSize is the number of bytes of fetched CI files kept in memory,
+	// FileCacheDir additionally keeps them on disk between crawls.
+	FileCacheSize int64  `conf:"default:67108864,env:FILE_CACHE_SIZE"`
+	FileCacheDir  string `conf:"env:FILE_CACHE_DIR"`
+	// ReportFormat is the output format of the reports: table, json or csv.
+	ReportFormat string `conf:"default:table,env:REPORT_FORMAT"`
+	// BumpDryRun prints the changes of the bump command as a diff instead of
+	// opening merge requests.
+	BumpDryRun bool `conf:"default:false,env:BUMP_DRY_RUN"`
+	// Args holds the command to run, without one the crawler runs.
+	Args conf.Args
 	// There should be global config composition maybe? For not this lives here
 	// though this is the global log level
 	LogLevel  int    `conf:"default:1,env:LOG_LEVEL"`
@@ -65,5 +131,17 @@ func ParseConfig(cfg *Config) error {
 		return fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if err := validateRefSelection(cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if _, err := newProjectFilter(cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if cfg.Resume && cfg.CheckpointFile == "" {
+		return errors.New("failed to parse config: resuming a crawl needs a checkpoint file")
+	}
+
 	return nil
 }
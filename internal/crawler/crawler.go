@@ -10,8 +10,12 @@ import (
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
+	"io/fs"
 	"net/http"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
 const gitlabCIFileName = ".gitlab-ci.yml"
@@ -19,42 +23,113 @@ const gitlabCIFileName = ".gitlab-ci.yml"
 type Crawler struct {
 	config       *Config
 	gitlabClient *gitlab.Client
+	remoteClient gitlab.HTTPDoer
 	storage      storage.Storage
 	logger       zerolog.Logger
 	nWorkers     int
+	tagPattern   *regexp.Regexp
+	filter       *projectFilter
+	refCache     *refCache
+	projectCache *projectCache
+	fileCache    *fileCache
+	// state is only set for incremental crawls.
+	state *crawlState
+	// progress is only set if checkpoints are written.
+	progress *progressTracker
+	failures *failureCollector
+	// groups are the groups the crawl is limited to, all projects
+	// of the instance are crawled if there are none.
+	groups []gitlab.Group
 }
 
 // New creates a new project crawler
 // The caller is responsible for closing the neo4j driver and session
 // the Crawl func handles this already.
 func New(cfg *Config, logger zerolog.Logger, store storage.Storage) (*Crawler, error) {
-	retryClient := retryablehttp.NewClient()
+	gitlabClient := NewGitLabClient(cfg, logger)
 
-	retryClient.RetryMax = cfg.HTTPClientMaxRetry
-	retryClient.RetryWaitMax = cfg.HTTPClientMaxRetryWait
-	retryClient.RetryWaitMin = cfg.HTTPClientMinRetryWait
-	retryClient.HTTPClient = &http.Client{Timeout: cfg.HTTPClientTimeout}
+	tagPattern, err := regexp.Compile(cfg.RefTagPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile tag pattern: %w", err)
+	}
 
-	httpClient := &rateLimitedHTTPClient{
-		Client:      retryClient.StandardClient(),
-		RateLimiter: rate.NewLimiter(rate.Limit(cfg.GitlabMaxRPS), cfg.GitlabMaxRPS),
+	fileCache, err := newFileCache(cfg.FileCacheSize, cfg.FileCacheDir)
+	if err != nil {
+		return nil, err
 	}
 
-	gitlabClient := gitlab.NewClient(cfg.GitlabHost, cfg.GitlabToken, httpClient, logger)
+	filter, err := newProjectFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Crawler{
 		config:       cfg,
 		gitlabClient: gitlabClient,
+		remoteClient: newRemoteClient(cfg),
 		storage:      store,
 		logger:       logger,
 		nWorkers:     cfg.NumberOfWorkers,
+		tagPattern:   tagPattern,
+		filter:       filter,
+		refCache:     newRefCache(),
+		projectCache: newProjectCache(),
+		failures:     &failureCollector{},
+		fileCache:    fileCache,
 	}, nil
 }
 
+// NewGitLabClient sets up a GitLab client that retries failed requests and
+// keeps to the configured rate limit, like the one the crawler uses itself.
+// Requests that change data are not retried, a retry after a timeout could
+// create the same branch or merge request twice.
+func NewGitLabClient(cfg *Config, logger zerolog.Logger) *gitlab.Client {
+	rateLimiter := rate.NewLimiter(rate.Limit(cfg.GitlabMaxRPS), cfg.GitlabMaxRPS)
+	httpClient := &rateLimitedHTTPClient{
+		Client:      newRetryClient(cfg).StandardClient(),
+		RateLimiter: rateLimiter,
+	}
+
+	client := gitlab.NewClient(cfg.GitlabHost, cfg.GitlabToken, httpClient, logger)
+	client.SendHTTPDoer = &rateLimitedHTTPClient{
+		Client:      &http.Client{Timeout: cfg.HTTPClientTimeout},
+		RateLimiter: rateLimiter,
+	}
+	return client
+}
+
+func newRetryClient(cfg *Config) *retryablehttp.Client {
+	retryClient := retryablehttp.NewClient()
+
+	retryClient.RetryMax = cfg.HTTPClientMaxRetry
+	retryClient.RetryWaitMax = cfg.HTTPClientMaxRetryWait
+	retryClient.RetryWaitMin = cfg.HTTPClientMinRetryWait
+	retryClient.HTTPClient = &http.Client{Timeout: cfg.HTTPClientTimeout}
+
+	return retryClient
+}
+
 // Crawl iterates through every project in the given GitLab host
 // and parses the CI file, and it's includes into the given Neo4j instance
 func (c *Crawler) Crawl(ctx context.Context) error {
-	if c.config.StorageCleanup {
+	started := time.Now()
+	streamOpts := gitlab.StreamOptions{PageSize: 100, Filter: c.filter.streamFilter()}
+
+	if c.config.Resume {
+		cp, err := loadCheckpoint(c.config.CheckpointFile)
+		if err != nil {
+			return err
+		}
+
+		started = cp.StartedAt
+		streamOpts.StartURL = cp.PageURL
+		streamOpts.StartAfterID = cp.LastProjectID
+
+		c.logger.Info().
+			Str("PageURL", cp.PageURL).
+			Int("LastProjectID", cp.LastProjectID).
+			Msg("resuming crawl from checkpoint")
+	} else if c.config.StorageCleanup {
 		c.logger.Info().Msg("Cleanup storage...")
 		err := c.storage.RemoveAll(ctx)
 		if err != nil {
@@ -62,7 +137,49 @@ func (c *Crawler) Crawl(ctx context.Context) error {
 		}
 	}
 
-	c.logger.Info().Msg("Starting to crawl...")
+	if len(c.config.Groups) > 0 {
+		groups, err := c.resolveGroups(ctx, c.config.Groups)
+		if err != nil {
+			return err
+		}
+		c.groups = groups
+	}
+
+	if c.config.StateFile != "" {
+		state, err := loadCrawlState(c.config.StateFile)
+		if err != nil {
+			return err
+		}
+		c.state = state
+		streamOpts.LastActivityAfter = state.activityAfter()
+	}
+
+	var failedBefore map[int]string
+	if c.state != nil {
+		failedBefore = c.state.failedProjects()
+	}
+
+	stopCheckpoints := func() {}
+	if c.config.CheckpointFile != "" {
+		c.progress = newProgressTracker(checkpoint{StartedAt: started})
+		streamOpts.OnPage = c.progress.page
+
+		checkpointCtx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			c.writeCheckpoints(checkpointCtx, c.progress, c.config.CheckpointInterval)
+		}()
+
+		stopCheckpoints = func() {
+			cancel()
+			<-stopped
+		}
+	}
+
+	c.logger.Info().
+		Time("LastActivityAfter", streamOpts.LastActivityAfter).
+		Msg("Starting to crawl...")
 	resultChan := make(chan gitlab.Project, 200)
 
 	var streamOK bool
@@ -70,11 +187,12 @@ func (c *Crawler) Crawl(ctx context.Context) error {
 	go func() {
 		defer close(resultChan)
 
-		if err := c.gitlabClient.StreamAllProjects(ctx, 100, resultChan); err != nil {
+		if err := c.streamProjects(ctx, streamOpts, resultChan); err != nil {
 			c.logger.Err(err).Msg("stopping crawler: error in project stream")
 			return
 		}
 
+		c.retryFailedProjects(ctx, failedBefore, resultChan)
 		streamOK = true
 	}()
 
@@ -88,6 +206,9 @@ func (c *Crawler) Crawl(ctx context.Context) error {
 			})
 	}
 	err := errs.Wait()
+	c.fileCache.logStats(c.logger)
+	stopCheckpoints()
+	reportErr := c.finishFailureReport(started)
 	if err != nil {
 		return err
 	}
@@ -96,19 +217,51 @@ func (c *Crawler) Crawl(ctx context.Context) error {
 		return errors.New("stream failed")
 	}
 
+	if c.state != nil {
+		c.state.LastCrawl = started
+		if err := c.state.save(c.config.StateFile); err != nil {
+			return err
+		}
+	}
+
+	if c.config.CheckpointFile != "" {
+		if err := os.Remove(c.config.CheckpointFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove checkpoint: %w", err)
+		}
+	}
+
 	c.logger.Info().Msg("stopped crawling")
-	return nil
+	return reportErr
 }
 
 func (c *Crawler) updateProjectInGraphWorker(ctx context.Context, projects chan gitlab.Project) error {
 	for p := range projects {
+		if reason := c.filter.skip(p); reason != "" {
+			c.logger.Debug().
+				Str("ProjectPath", p.PathWithNamespace).
+				Str("Reason", reason).
+				Msg("skipping filtered project")
+			c.progress.done(p.ID)
+			continue
+		}
+
+		// Failures of a single project end up in the failure report,
+		// only a cancelled crawl stops the workers.
 		if err := c.updateProjectInGraph(ctx, p); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+
+			c.state.failed(p, nil)
 			c.logger.Err(err).
 				Str("ProjectPath", p.PathWithNamespace).
 				Int("ProjectID", p.ID).
 				Msg("failed to parse project")
-			return err
+			c.recordFailure(projectSource(p, "", nil), err)
 		}
+
+		c.failures.crawled()
+		c.progress.done(p.ID)
 	}
 	return nil
 }
@@ -118,6 +271,29 @@ func (c *Crawler) updateProjectInGraph(ctx context.Context, project gitlab.Proje
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
+		c.projectCache.add(project)
+
+		var blobID string
+		if c.state != nil {
+			changed, id, err := c.projectChanged(ctx, project)
+			if err != nil {
+				c.logger.Warn().
+					Err(err).
+					Str("Project", project.PathWithNamespace).
+					Msg("failed to check for changes, crawling project again")
+				changed = true
+			}
+
+			if !changed {
+				c.logger.Debug().
+					Str("Project", project.PathWithNamespace).
+					Msg("skipping project, pipeline did not change since the last crawl")
+				c.state.touched(project)
+				return nil
+			}
+			blobID = id
+		}
+
 		if err := c.storage.CreateProjectNode(ctx, project.PathWithNamespace); err != nil {
 			return fmt.Errorf("failed to write project to neo4j: %w", err)
 		}
@@ -130,112 +306,586 @@ func (c *Crawler) updateProjectInGraph(ctx context.Context, project gitlab.Proje
 			return nil
 		}
 
-		err := c.handleIncludes(ctx, project, gitlabCIFileName, make(map[string]struct{}))
+		refs, err := c.selectRefs(ctx, project)
 		if err != nil {
-			c.logger.Error().
-				Err(err).
-				Str("Project", project.PathWithNamespace).
-				Msg("failed to handle all includes")
+			return err
+		}
+
+		names := make([]string, 0, len(refs))
+		for _, r := range refs {
+			names = append(names, r.name)
+		}
+
+		if c.state != nil {
+			if err := c.removeProjectEdges(ctx, project, names); err != nil {
+				return err
+			}
+		}
+
+		failed := false
+		for _, ref := range refs {
+			err := c.handleCIConfig(ctx, project, ref, make(map[string]struct{}))
+			if err != nil {
+				failed = true
+				c.logger.Error().
+					Err(err).
+					Str("Project", project.PathWithNamespace).
+					Str("Ref", ref.name).
+					Msg("failed to handle all includes")
+
+				source := projectSource(project, "", nil)
+				source.ref = ref.name
+				c.recordFailure(source, err)
+			}
+		}
+
+		// A project with a failed ref is crawled again next time,
+		// even without any activity.
+		if failed {
+			c.state.failed(project, names)
+		} else if c.state != nil {
+			c.state.crawled(project, blobID, names)
 		}
 		return nil
 	}
 }
 
-func (c *Crawler) handleIncludes(ctx context.Context, project gitlab.Project, filePath string, cycleDetectionMap map[string]struct{}) error {
-	if _, found := cycleDetectionMap[project.PathWithNamespace + "--" + filePath]; found {
-		projectsVisited := make([]string, 0, len(cycleDetectionMap))
-		for k := range cycleDetectionMap {
-			projectsVisited = append(projectsVisited, k)
+// removeProjectEdges deletes the edges the pipelines of a changed project found
+// in a previous crawl, including those inside of included files that no other
+// pipeline found. Projects crawled for the first time have none. The refs of
+// the previous crawl are removed as well, refs that are no longer selected,
+// like a deleted branch, would keep their edges forever otherwise.
+func (c *Crawler) removeProjectEdges(ctx context.Context, project gitlab.Project, refs []string) error {
+	previous, known := c.state.project(project.ID)
+	if !known {
+		return nil
+	}
+
+	names := mergeRefs(previous.Refs, refs)
+	if err := c.storage.RemoveProjectEdges(ctx, project.PathWithNamespace, names); err != nil {
+		return fmt.Errorf("failed to remove edges of %s: %w", project.PathWithNamespace, err)
+	}
+	return nil
+}
+
+// handleCIConfig starts the traversal at the project's CI configuration file
+// at the given ref. If the configuration lives outside the project it is
+// modelled as an include of the file hosting it.
+func (c *Crawler) handleCIConfig(ctx context.Context, project gitlab.Project, ref pipelineRef, cycleDetectionMap map[string]struct{}) error {
+	vars := c.pipelineVariables(ctx, project, ref)
+	source := projectSource(project, "", vars)
+	source.ref = ref.name
+	source.jobs = &jobIndex{}
+
+	ciConfig := parseCIConfigPath(project.CIConfigPath)
+
+	var err error
+	switch {
+	case ciConfig.Remote != "":
+		err = c.handleRemoteInclude(ctx, source, ciConfig, cycleDetectionMap)
+	case ciConfig.Project != "":
+		if ciConfig.Ref == "" {
+			ciConfig.Ref = c.config.DefaultRefName
 		}
-		return errors.New("cycle detected, this should not be possible, the projects visited are: " + strings.Join(projectsVisited[:], ","))
+		err = c.handleProjectInclude(ctx, source, ciConfig, cycleDetectionMap)
+	default:
+		ciFile := projectSource(project, ciConfig.Local, vars)
+		ciFile.ref = ref.name
+		ciFile.jobs = source.jobs
+		err = c.handleIncludes(ctx, ciFile, cycleDetectionMap)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.storeJobs(ctx, source.pipeline(), source.jobs)
+}
+
+// ciFileSource describes where a CI file was read from, all edges found
+// while parsing the file start at this node.
+// project, file and ref are only set for files that live inside a GitLab project,
+// ref is the branch or tag the file is read at.
+// variables are the variables of the pipeline the file is part of, they
+// are passed down to every included file.
+type ciFileSource struct {
+	nodeType  storage.NodeType
+	name      string
+	project   gitlab.Project
+	file      string
+	ref       string
+	variables *ciVariables
+	// includedBy is the file that included this one together with the
+	// inputs it passed, it is nil for the file a pipeline starts at.
+	includedBy *ciFileSource
+	inputs     map[string]interface{}
+	// jobs collects the jobs of every file in the pipeline.
+	jobs *jobIndex
+}
+
+func projectSource(project gitlab.Project, file string, vars *ciVariables) ciFileSource {
+	return ciFileSource{
+		nodeType:  storage.NodeTypeProject,
+		name:      project.PathWithNamespace,
+		project:   project,
+		file:      file,
+		ref:       project.DefaultBranch,
+		variables: vars,
+	}
+}
+
+// pipeline returns the PipelineID of the pipeline the file is part of.
+func (s ciFileSource) pipeline() string {
+	root := s.pipelineRoot()
+	return storage.PipelineID(root.name, root.ref)
+}
+
+// include returns the source of a file that is included by s through the given include.
+func (s ciFileSource) include(included ciFileSource, include RemoteInclude) ciFileSource {
+	included.variables = s.variables
+	included.jobs = s.jobs
+	included.includedBy = &s
+	included.inputs = include.Inputs
+	return included
+}
+
+// fileNode returns the type and identity of the node representing the file
+// itself, files inside of projects have their own node.
+func (s ciFileSource) fileNode() (storage.NodeType, string) {
+	if s.nodeType == storage.NodeTypeProject {
+		return storage.NodeTypeFile, storage.FileID(s.name, s.file, s.ref)
 	}
-	cycleDetectionMap[project.PathWithNamespace + "--" + filePath] = struct{}{}
+	return s.nodeType, s.name
+}
+
+// pipelineRoot follows the files including s back to the file the pipeline
+// started at, for child pipelines that is the file of the parent pipeline.
+func (s ciFileSource) pipelineRoot() ciFileSource {
+	for s.includedBy != nil {
+		s = *s.includedBy
+	}
+	return s
+}
 
-	gitlabCIFile, err := c.gitlabClient.GetRawFileFromProject(ctx, project.ID, filePath, project.DefaultBranch)
+func (c *Crawler) handleIncludes(ctx context.Context, source ciFileSource, cycleDetectionMap map[string]struct{}) error {
+	leave, err := detectCycle(cycleDetectionMap, source.name+"--"+source.file+"@"+source.ref)
 	if err != nil {
+		return inFile(source, err)
+	}
+	defer leave()
+
+	gitlabCIFile, err := c.getProjectFile(ctx, source)
+	if err != nil {
+		// Most projects have no CI file, only included files that
+		// cannot be read break a pipeline.
+		if source.includedBy != nil {
+			brokenErr := c.handleBrokenInclude(ctx, *source.includedBy, source.project.PathWithNamespace, source.ref, []string{source.file}, err)
+			if brokenErr != nil {
+				return inFile(source, brokenErr)
+			}
+		}
+
+		// A broken include is recorded, the remaining includes of the
+		// parent are still followed.
+		if _, broken := brokenReason(err); broken && source.includedBy != nil {
+			c.recordFailure(source, err)
+			return nil
+		}
 		if errors.Is(err, gitlab.ErrRawFileNotFound) {
 			return nil
 		}
-		return fmt.Errorf("failed to get file %s: %w", filePath, err)
+		return inFile(source, fmt.Errorf("failed to get file %s: %w", source.file, err))
+	}
+
+	return inFile(source, c.handleCIFile(ctx, source, gitlabCIFile, cycleDetectionMap))
+}
+
+// handleRemoteInclude records a remote include in the storage and, if the host is
+// allowed, downloads the file to follow its triggers and includes.
+func (c *Crawler) handleRemoteInclude(ctx context.Context, parent ciFileSource, include RemoteInclude, cycleDetectionMap map[string]struct{}) error {
+	if err := c.storage.CreateRemoteFileNode(ctx, include.Remote); err != nil {
+		return fmt.Errorf("failed to write remote file to storage: %w", err)
+	}
+
+	if err := c.storage.CreateIncludeEdge(ctx, storage.Edge{
+		SourceType:    parent.nodeType,
+		SourceProject: parent.name,
+		SourceRef:     parent.ref,
+		Pipeline:      parent.pipeline(),
+		TargetType:    storage.NodeTypeRemoteFile,
+		TargetProject: include.Remote,
+		Unresolved:    include.Unresolved,
+		Properties:    include.edgeProperties(),
+	}); err != nil {
+		return fmt.Errorf("failed to write remote include edge: %w", err)
+	}
+
+	if include.Unresolved {
+		return nil
+	}
+
+	return c.followRemoteFile(ctx, parent.include(ciFileSource{
+		nodeType: storage.NodeTypeRemoteFile,
+		name:     include.Remote,
+	}, include), cycleDetectionMap)
+}
+
+// followRemoteFile downloads a remote file and parses it, files on hosts that are
+// not allowed are not followed.
+func (c *Crawler) followRemoteFile(ctx context.Context, source ciFileSource, cycleDetectionMap map[string]struct{}) error {
+	leave, err := detectCycle(cycleDetectionMap, "remote--"+source.name)
+	if err != nil {
+		return inFile(source, err)
+	}
+	defer leave()
+
+	remoteFile, err := c.getRemoteFile(ctx, source.name)
+	if err != nil {
+		if errors.Is(err, ErrRemoteHostNotAllowed) {
+			c.logger.Debug().
+				Str("Remote", source.name).
+				Msg("not following remote include, host is not allowed")
+			return nil
+		}
+		return inFile(source, err)
+	}
+
+	return inFile(source, c.handleCIFile(ctx, source, remoteFile, cycleDetectionMap))
+}
+
+// handleTemplateInclude records an include of one of GitLab's built-in templates
+// and, if FollowBuiltinTemplates is set, fetches the template to follow its includes.
+func (c *Crawler) handleTemplateInclude(ctx context.Context, parent ciFileSource, include RemoteInclude, cycleDetectionMap map[string]struct{}) error {
+	if err := c.storage.CreateTemplateNode(ctx, include.Template); err != nil {
+		return fmt.Errorf("failed to write template to storage: %w", err)
+	}
+
+	if err := c.storage.CreateIncludeEdge(ctx, storage.Edge{
+		SourceType:    parent.nodeType,
+		SourceProject: parent.name,
+		SourceRef:     parent.ref,
+		Pipeline:      parent.pipeline(),
+		TargetType:    storage.NodeTypeTemplate,
+		TargetProject: include.Template,
+		Unresolved:    include.Unresolved,
+		Properties:    include.edgeProperties(),
+	}); err != nil {
+		return fmt.Errorf("failed to write template include edge: %w", err)
+	}
+
+	if include.Unresolved {
+		return nil
+	}
+
+	return c.followTemplate(ctx, parent.include(ciFileSource{
+		nodeType: storage.NodeTypeTemplate,
+		name:     include.Template,
+	}, include), cycleDetectionMap)
+}
+
+// followTemplate fetches a built-in template and parses it if FollowBuiltinTemplates is set.
+func (c *Crawler) followTemplate(ctx context.Context, source ciFileSource, cycleDetectionMap map[string]struct{}) error {
+	if !c.config.FollowBuiltinTemplates {
+		return nil
+	}
+
+	leave, err := detectCycle(cycleDetectionMap, "template--"+source.name)
+	if err != nil {
+		return inFile(source, err)
+	}
+	defer leave()
+
+	templateFile, err := c.gitlabClient.GetCITemplate(ctx, strings.TrimSuffix(source.name, ".gitlab-ci.yml"))
+	if err != nil {
+		if errors.Is(err, gitlab.ErrCITemplateNotFound) {
+			c.logger.Warn().
+				Str("Template", source.name).
+				Str("Source", source.includedBy.name).
+				Msg("built-in template does not exist on this GitLab instance")
+			return nil
+		}
+		return inFile(source, err)
 	}
 
-	triggers, err := c.parseTriggers(gitlabCIFile)
+	return inFile(source, c.handleCIFile(ctx, source, templateFile, cycleDetectionMap))
+}
+
+var ErrCycleDetected = errors.New("cycle detected, this should not be possible")
+
+// detectCycle marks key as being followed. The returned func unmarks it once
+// the file and everything it includes was handled, so only a file including
+// itself is a cycle and not one that is included twice along different paths.
+func detectCycle(cycleDetectionMap map[string]struct{}, key string) (func(), error) {
+	if _, found := cycleDetectionMap[key]; found {
+		projectsVisited := make([]string, 0, len(cycleDetectionMap))
+		for k := range cycleDetectionMap {
+			projectsVisited = append(projectsVisited, k)
+		}
+		return nil, fmt.Errorf("%w, the projects visited are: %s", ErrCycleDetected, strings.Join(projectsVisited[:], ","))
+	}
+	cycleDetectionMap[key] = struct{}{}
+	return func() { delete(cycleDetectionMap, key) }, nil
+}
+
+// handleCIFile parses the triggers and includes of a single CI file and
+// recurses into every included file. The file is parsed once, all parse
+// helpers read from the same documents.
+func (c *Crawler) handleCIFile(ctx context.Context, source ciFileSource, gitlabCIFile []byte, cycleDetectionMap map[string]struct{}) error {
+	documents, err := decodeCIFile(gitlabCIFile)
 	if err != nil {
-		return fmt.Errorf("failed to parse triggers: %w", err)
+		return fmt.Errorf("failed to parse ci file: %w", err)
 	}
 
-	triggers = c.enrichTriggers(triggers, project.PathWithNamespace)
+	parsed, err := mergeDocuments(documents)
+	if err != nil {
+		return fmt.Errorf("failed to parse ci file: %w", err)
+	}
+
+	source.variables = source.variables.withFileVariables(c.parseVariables(parsed))
+
+	if err := c.handleSpec(ctx, source, c.parseSpec(parsed)); err != nil {
+		c.logger.Err(err).
+			Str("Source", source.name).
+			Str("File", source.file).
+			Msg("failed to handle spec")
+		c.recordFailure(source, err)
+	}
+
+	jobs := c.parseJobs(documents)
+	triggers := c.parseTriggers(parsed)
+	triggers = c.expandTriggers(triggers, source.variables)
+	triggers = c.enrichTriggers(triggers, source.ref, source.project.PathWithNamespace)
 
 	for _, trigger := range triggers {
+		if len(trigger.Includes) > 0 {
+			if err := c.handleChildPipeline(ctx, source, trigger, cycleDetectionMap); err != nil {
+				c.logger.Err(err).
+					Str("Source", source.name).
+					Str("Job", trigger.Job).
+					Msg("failed to handle child pipeline")
+				c.recordFailure(source, err)
+			}
+			continue
+		}
+
+		if trigger.Project == "" {
+			c.logger.Debug().
+				Str("Source", source.name).
+				Str("Job", trigger.Job).
+				Msg("skipping trigger that cannot be resolved to a project")
+			continue
+		}
+
 		c.logger.Debug().Dict("trigger", zerolog.Dict().
 			Str("Project", trigger.Project).
-			Str("SourceProject", project.PathWithNamespace),
+			Str("SourceProject", source.name),
 		).Msg("")
-		err := c.storage.CreateTriggerEdge(ctx, storage.Edge{
-			SourceProject: project.PathWithNamespace,
+
+		targetType, err := c.createProjectTarget(ctx, trigger.Project)
+		if err != nil {
+			c.logger.Err(err).
+				Str("Project", trigger.Project).
+				Msg("failed to write project to storage")
+			c.recordFailure(source, err)
+			continue
+		}
+
+		err = c.storage.CreateTriggerEdge(ctx, storage.Edge{
+			SourceType:    source.nodeType,
+			SourceProject: source.name,
+			SourceRef:     source.ref,
+			Pipeline:      source.pipeline(),
+			TargetType:    targetType,
 			TargetProject: trigger.Project,
-			Ref: trigger.Branch,
+			Ref:           trigger.Branch,
+			Unresolved:    trigger.Unresolved,
+			Properties:    c.refProperties(ctx, trigger.edgeProperties(), trigger.Project, trigger.Branch, trigger.Unresolved),
 		})
 		if err != nil {
 			c.logger.Err(err).
-				Str("Project", project.PathWithNamespace).
+				Str("Project", source.name).
 				Msg("failed to create trigger edge")
+			c.recordFailure(source, err)
 		}
 	}
 
-	includes, err := c.parseIncludes(gitlabCIFile)
+	if err := c.handleNeeds(ctx, source, c.parseNeeds(parsed)); err != nil {
+		c.logger.Err(err).
+			Str("Project", source.name).
+			Msg("failed to create needs edges")
+		c.recordFailure(source, err)
+	}
+
+	if err := c.handleImages(ctx, source, c.parseImages(parsed)); err != nil {
+		c.logger.Err(err).
+			Str("Project", source.name).
+			Msg("failed to create image edges")
+		c.recordFailure(source, err)
+	}
+
+	includes, err := c.parseIncludes(parsed)
 	if err != nil {
 		return fmt.Errorf("failed to parse includes: %w", err)
 	}
 
+	includes = c.expandIncludes(includes, source.variables)
 	includes = c.enrichIncludes(
 		includes,
-		project.DefaultBranch,
-		project.PathWithNamespace,
+		source.ref,
+		source.project.PathWithNamespace,
 		c.config.DefaultRefName,
 	)
 
 	for _, i := range includes {
-		if i.Ref == "" {
-			c.logger.Warn().
-				Str("Project", i.Project).
-				Str("Files", strings.Join(i.Files, ",")).
-				Msg("Got empty ref")
+		if i.Remote != "" {
+			if err := c.handleRemoteInclude(ctx, source, i, cycleDetectionMap); err != nil {
+				c.logger.Err(err).
+					Str("Remote", i.Remote).
+					Msg("failed to handle remote include")
+				c.recordFailure(source, err)
+			}
+			continue
+		}
+
+		if i.Template != "" {
+			if err := c.handleTemplateInclude(ctx, source, i, cycleDetectionMap); err != nil {
+				c.logger.Err(err).
+					Str("Template", i.Template).
+					Msg("failed to handle template include")
+				c.recordFailure(source, err)
+			}
+			continue
 		}
 
-		if err = c.traverseIncludes(ctx, project.PathWithNamespace, i); err != nil {
+		if i.Component != "" {
+			if err := c.handleComponentInclude(ctx, source, i, cycleDetectionMap); err != nil {
+				c.logger.Err(err).
+					Str("Component", i.Component).
+					Msg("failed to handle component include")
+				c.recordFailure(source, err)
+			}
+			continue
+		}
+
+		if i.Project == "" {
+			c.logger.Debug().
+				Str("Source", source.name).
+				Str("Local", i.Local).
+				Msg("skipping include that cannot be resolved to a project")
+			continue
+		}
+
+		if err := c.handleProjectInclude(ctx, source, i, cycleDetectionMap); err != nil {
 			c.logger.Err(err).
 				Str("Project", i.Project).
-				Msg("failed to parse include")
+				Msg("failed to handle project include")
+			c.recordFailure(source, err)
 		}
+	}
 
-		p, err := c.gitlabClient.GetProjectFromPath(ctx, i.Project)
-		if err != nil {
+	// The jobs of a file are added after the jobs of its includes since
+	// a file overrides the jobs it includes.
+	source.jobs.add(source, jobs)
+
+	return nil
+}
+
+// handleProjectInclude records an include of files from a project and
+// recurses into every one of the included files.
+func (c *Crawler) handleProjectInclude(ctx context.Context, parent ciFileSource, include RemoteInclude, cycleDetectionMap map[string]struct{}) error {
+	if include.Ref == "" {
+		c.logger.Warn().
+			Str("Project", include.Project).
+			Str("Files", strings.Join(include.Files, ",")).
+			Msg("Got empty ref")
+	}
+
+	if err := c.traverseIncludes(ctx, parent, include); err != nil {
+		c.logger.Err(err).
+			Str("Project", include.Project).
+			Msg("failed to parse include")
+		c.recordFailure(parent, err)
+	}
+
+	if include.Unresolved {
+		c.logger.Debug().
+			Str("Project", include.Project).
+			Str("Files", strings.Join(include.Files, ",")).
+			Msg("not following include with unresolved variables")
+		return nil
+	}
+
+	p, err := c.getProject(ctx, include.Project)
+	if err != nil {
+		if err := c.handleBrokenInclude(ctx, parent, include.Project, include.Ref, include.Files, err); err != nil {
 			return err
 		}
+		return c.handleMissingProject(ctx, include.Project, err)
+	}
 
-		for _, f := range i.Files {
-			err = c.handleIncludes(ctx, p, f, cycleDetectionMap)
-			if err != nil {
-				return err
-			}
+	ref := fileRef(include, p)
+	if include.Local != "" {
+		c.state.markLocalInclude(parent.pipelineRoot().project.ID)
+	}
+
+	files := include.Files
+	if include.Local != "" && isLocalGlob(include.Local) {
+		files, err = c.expandLocalGlob(ctx, p, include.Local, ref)
+		if err != nil {
+			return fmt.Errorf("failed to expand local include %s: %w", include.Local, err)
+		}
+
+		c.logger.Debug().
+			Str("Project", p.PathWithNamespace).
+			Str("Local", include.Local).
+			Str("Files", strings.Join(files, ",")).
+			Msg("expanded wildcard local include")
+	}
+
+	// A file that fails does not keep the other files of the include from
+	// being crawled, the failure ends up in the failure report.
+	for _, f := range files {
+		included := parent.include(projectSource(p, f, nil), include)
+		included.ref = ref
+		if err := c.handleIncludes(ctx, included, cycleDetectionMap); err != nil {
+			c.logger.Err(err).
+				Str("Project", p.PathWithNamespace).
+				Str("File", f).
+				Msg("failed to handle included file")
+			c.recordFailure(included, err)
 		}
 	}
 
 	return nil
 }
 
-func (c *Crawler) traverseIncludes(ctx context.Context, parentName string, include RemoteInclude) error {
+// fileRef is the ref the files of an include are read at. Local includes carry
+// the ref of the file including them, so nested local includes stay at the ref
+// the consumer asked for. Includes without a ref use the default branch.
+func fileRef(include RemoteInclude, project gitlab.Project) string {
+	if include.Ref == "" || include.Ref == "HEAD" {
+		return project.DefaultBranch
+	}
+	return include.Ref
+}
 
-	if err := c.storage.CreateProjectNode(ctx, include.Project); err != nil {
-		return fmt.Errorf("failed to write project to neo4j: %w", err)
+func (c *Crawler) traverseIncludes(ctx context.Context, parent ciFileSource, include RemoteInclude) error {
+
+	targetType, err := c.createProjectTarget(ctx, include.Project)
+	if err != nil {
+		return err
 	}
 
 	if err := c.storage.CreateIncludeEdge(ctx, storage.Edge{
-		SourceProject: parentName,
+		SourceType:    parent.nodeType,
+		SourceProject: parent.name,
+		SourceRef:     parent.ref,
+		Pipeline:      parent.pipeline(),
+		TargetType:    targetType,
 		TargetProject: include.Project,
 		Ref:           include.Ref,
 		Files:         include.Files,
+		Unresolved:    include.Unresolved,
+		Properties:    c.refProperties(ctx, include.edgeProperties(), include.Project, include.Ref, include.Unresolved),
 	}); err != nil {
 		return fmt.Errorf("failed to write neo4j transaction: %w", err)
 	}
@@ -0,0 +1,215 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// The classes failures are grouped by in the failure report.
+const (
+	FailureClassYAML      = "yaml"
+	FailureClassNotFound  = "not-found"
+	FailureClassForbidden = "forbidden"
+	FailureClassTimeout   = "timeout"
+	FailureClassCycle     = "cycle"
+	FailureClassOther     = "other"
+)
+
+// ErrTooManyFailures is returned by Crawl once more projects failed than
+// MaxFailedProjects allows, the graph is complete apart from those projects.
+var ErrTooManyFailures = errors.New("too many projects failed")
+
+// Failure is something that went wrong while crawling a project. File and Ref
+// point to the file that could not be handled, which may belong to a project
+// included by Project.
+type Failure struct {
+	Project string `json:"project"`
+	File    string `json:"file,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+	Class   string `json:"class"`
+	Error   string `json:"error"`
+}
+
+// FailureReport is written to the FailureReportFile once a crawl ends.
+type FailureReport struct {
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     time.Time      `json:"finished_at"`
+	Projects       int            `json:"projects"`
+	FailedProjects int            `json:"failed_projects"`
+	Classes        map[string]int `json:"classes"`
+	Failures       []Failure      `json:"failures"`
+}
+
+// failureCollector gathers the failures of all workers.
+type failureCollector struct {
+	mu       sync.Mutex
+	projects int
+	failures []Failure
+}
+
+func (fc *failureCollector) add(f Failure) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.failures = append(fc.failures, f)
+}
+
+// crawled counts a project that was handled, with or without failures.
+func (fc *failureCollector) crawled() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.projects++
+}
+
+func (fc *failureCollector) failedProjects() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	failed := make(map[string]struct{})
+	for _, f := range fc.failures {
+		failed[f.Project] = struct{}{}
+	}
+	return len(failed)
+}
+
+func (fc *failureCollector) report(startedAt time.Time) FailureReport {
+	failedProjects := fc.failedProjects()
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	failures := make([]Failure, len(fc.failures))
+	copy(failures, fc.failures)
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Project < failures[j].Project
+	})
+
+	classes := make(map[string]int)
+	for _, f := range failures {
+		classes[f.Class]++
+	}
+
+	return FailureReport{
+		StartedAt:      startedAt,
+		FinishedAt:     time.Now(),
+		Projects:       fc.projects,
+		FailedProjects: failedProjects,
+		Classes:        classes,
+		Failures:       failures,
+	}
+}
+
+// fileError ties an error to the file it happened in, only the innermost file
+// of a chain of includes is kept.
+type fileError struct {
+	file string
+	ref  string
+	err  error
+}
+
+func (fe *fileError) Error() string {
+	return fe.err.Error()
+}
+
+func (fe *fileError) Unwrap() error {
+	return fe.err
+}
+
+// inFile marks err as having happened while handling the file of source.
+func inFile(source ciFileSource, err error) error {
+	var fe *fileError
+	if err == nil || errors.As(err, &fe) {
+		return err
+	}
+
+	file := source.file
+	if source.nodeType != storage.NodeTypeProject {
+		file = source.name
+	}
+
+	return &fileError{file: file, ref: source.ref, err: err}
+}
+
+// recordFailure adds an error that happened while crawling the pipeline of
+// source to the failure report, the crawl itself continues.
+func (c *Crawler) recordFailure(source ciFileSource, err error) {
+	root := source.pipelineRoot()
+
+	failure := Failure{
+		Project: root.name,
+		Ref:     root.ref,
+		Class:   classifyError(err),
+		Error:   err.Error(),
+	}
+
+	var fe *fileError
+	if errors.As(inFile(source, err), &fe) {
+		failure.File = fe.file
+		failure.Ref = fe.ref
+	}
+
+	c.failures.add(failure)
+}
+
+func classifyError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrInvalidYAML):
+		return FailureClassYAML
+	case errors.Is(err, gitlab.ErrRawFileNotFound),
+		errors.Is(err, gitlab.ErrProjectNotFound),
+		errors.Is(err, gitlab.ErrRefNotFound),
+		errors.Is(err, gitlab.ErrCITemplateNotFound):
+		return FailureClassNotFound
+	case errors.Is(err, gitlab.ErrRawFileForbidden),
+		errors.Is(err, gitlab.ErrProjectForbidden):
+		return FailureClassForbidden
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return FailureClassTimeout
+	case errors.Is(err, ErrCycleDetected):
+		return FailureClassCycle
+	default:
+		return FailureClassOther
+	}
+}
+
+// finishFailureReport writes the failure report if one is configured and
+// checks the number of failed projects against MaxFailedProjects.
+func (c *Crawler) finishFailureReport(startedAt time.Time) error {
+	report := c.failures.report(startedAt)
+
+	c.logger.Info().
+		Int("Projects", report.Projects).
+		Int("FailedProjects", report.FailedProjects).
+		Interface("Classes", report.Classes).
+		Msg("crawl failures")
+
+	if c.config.FailureReportFile != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal failure report: %w", err)
+		}
+
+		if err := os.WriteFile(c.config.FailureReportFile, b, 0o644); err != nil {
+			return fmt.Errorf("failed to write failure report: %w", err)
+		}
+	}
+
+	if c.config.MaxFailedProjects >= 0 && report.FailedProjects > c.config.MaxFailedProjects {
+		return fmt.Errorf("%w: %d of %d projects failed, at most %d are allowed",
+			ErrTooManyFailures, report.FailedProjects, report.Projects, c.config.MaxFailedProjects)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	testData := []struct {
+		Name     string
+		Err      error
+		Expected string
+	}{
+		{Name: "YAML", Err: fmt.Errorf("%w: yaml: line 3", ErrInvalidYAML), Expected: FailureClassYAML},
+		{Name: "MissingFile", Err: &gitlab.RawFileError{Err: gitlab.ErrRawFileNotFound}, Expected: FailureClassNotFound},
+		{Name: "MissingProject", Err: fmt.Errorf("lookup: %w", gitlab.ErrProjectNotFound), Expected: FailureClassNotFound},
+		{Name: "ForbiddenFile", Err: &gitlab.RawFileError{Err: gitlab.ErrRawFileForbidden}, Expected: FailureClassForbidden},
+		{Name: "Timeout", Err: fmt.Errorf("request: %w", context.DeadlineExceeded), Expected: FailureClassTimeout},
+		{Name: "Cycle", Err: fmt.Errorf("%w, the projects visited are: a", ErrCycleDetected), Expected: FailureClassCycle},
+		{Name: "Other", Err: errors.New("boom"), Expected: FailureClassOther},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			assert.Equal(t, td.Expected, classifyError(td.Err))
+		})
+	}
+}
+
+func TestRecordFailureKeepsInnermostFile(t *testing.T) {
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	assert.NoError(t, err)
+
+	root := projectSource(gitlab.Project{PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	template := root.include(ciFileSource{
+		nodeType: root.nodeType,
+		name:     "platform/ci-templates",
+		file:     "build.yml",
+		ref:      "v1.0.0",
+	}, RemoteInclude{})
+
+	err = inFile(template, fmt.Errorf("%w: yaml: line 3", ErrInvalidYAML))
+	err = inFile(root, fmt.Errorf("failed to parse include: %w", err))
+	crawler.recordFailure(template, err)
+
+	report := crawler.failures.report(time.Time{})
+	assert.Equal(t, []Failure{{
+		Project: "team/app",
+		File:    "build.yml",
+		Ref:     "v1.0.0",
+		Class:   FailureClassYAML,
+		Error:   err.Error(),
+	}}, report.Failures)
+}
+
+func TestFinishFailureReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failures.json")
+	crawler, err := New(&Config{FailureReportFile: path, MaxFailedProjects: 1}, zerolog.Logger{}, NilStorage{})
+	assert.NoError(t, err)
+
+	for _, project := range []string{"team/app", "team/api", "team/web"} {
+		crawler.failures.crawled()
+		if project == "team/web" {
+			continue
+		}
+		source := projectSource(gitlab.Project{PathWithNamespace: project, DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+		crawler.recordFailure(source, fmt.Errorf("%w: bad", ErrInvalidYAML))
+	}
+
+	err = crawler.finishFailureReport(time.Now())
+	assert.ErrorIs(t, err, ErrTooManyFailures)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var report FailureReport
+	assert.NoError(t, json.Unmarshal(b, &report))
+	assert.Equal(t, 3, report.Projects)
+	assert.Equal(t, 2, report.FailedProjects)
+	assert.Equal(t, map[string]int{FailureClassYAML: 2}, report.Classes)
+	assert.Equal(t, "team/api", report.Failures[0].Project)
+
+	crawler.config.MaxFailedProjects = -1
+	assert.NoError(t, crawler.finishFailureReport(time.Now()))
+}
+
+func TestCrawlerContinuesAfterFailingProjectInclude(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                          `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/branches/main": `{"name":"main","commit":{"id":"abc"}}`,
+		"/api/v4/projects/2/repository/files/broken.yml/raw@abc":  "build: [unclosed\n",
+		"/api/v4/projects/2/repository/files/test.yml/raw@abc":    "test:\n  script: [echo]\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	assert.NoError(t, err)
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	ciFile := []byte(`include:
+  - project: platform/ci
+    ref: main
+    file: /broken.yml
+  - project: platform/ci
+    ref: main
+    file: /test.yml
+deploy:
+  script: [echo]
+`)
+	assert.NoError(t, crawler.handleCIFile(context.TODO(), source, ciFile, make(map[string]struct{})))
+
+	jobs := make([]string, 0)
+	for _, d := range source.jobs.definitions {
+		jobs = append(jobs, d.job.Name)
+	}
+	assert.Equal(t, []string{"test", "deploy"}, jobs)
+
+	report := crawler.failures.report(time.Time{})
+	assert.Len(t, report.Failures, 1)
+	assert.Equal(t, "/broken.yml", report.Failures[0].File)
+	assert.Equal(t, FailureClassYAML, report.Failures[0].Class)
+}
+
+func TestCrawlerDiamondIncludeIsNoCycle(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                          `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/branches/main": `{"name":"main","commit":{"id":"abc"}}`,
+		"/api/v4/projects/2/repository/files/build.yml/raw@abc":   "include:\n  - local: /d.yml\n",
+		"/api/v4/projects/2/repository/files/test.yml/raw@abc":    "include:\n  - local: /d.yml\n",
+		"/api/v4/projects/2/repository/files/d.yml/raw@abc":       "lint:\n  script: [echo]\n",
+		"/api/v4/projects/2/repository/files/loop.yml/raw@abc":    "include:\n  - local: /loop.yml\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	assert.NoError(t, err)
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	// build.yml and test.yml both include d.yml.
+	ciFile := []byte(`include:
+  - project: platform/ci
+    ref: main
+    file: [/build.yml, /test.yml]
+`)
+	assert.NoError(t, crawler.handleCIFile(context.TODO(), source, ciFile, make(map[string]struct{})))
+	assert.Empty(t, crawler.failures.report(time.Time{}).Failures)
+
+	// A file including itself still is a cycle.
+	ciFile = []byte(`include:
+  - project: platform/ci
+    ref: main
+    file: /loop.yml
+`)
+	assert.NoError(t, crawler.handleCIFile(context.TODO(), source, ciFile, make(map[string]struct{})))
+
+	report := crawler.failures.report(time.Time{})
+	assert.Len(t, report.Failures, 1)
+	assert.Equal(t, FailureClassCycle, report.Failures[0].Class)
+}
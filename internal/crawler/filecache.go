@@ -0,0 +1,206 @@
+package crawler
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+// fileCache holds the content of files read from GitLab keyed by the project,
+// path and commit SHA they were read at. Content at a commit never changes, so
+// entries are never invalidated and the optional directory can be kept between
+// crawls. Concurrent requests for the same file share a single API call.
+type fileCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+
+	dir   string
+	group singleflight.Group
+
+	hits     atomic.Int64
+	diskHits atomic.Int64
+	misses   atomic.Int64
+}
+
+type fileCacheEntry struct {
+	key     string
+	content []byte
+}
+
+// newFileCache sets up a cache keeping at most maxBytes of file content in
+// memory, files are also written to dir unless it is empty.
+func newFileCache(maxBytes int64, dir string) (*fileCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create file cache directory: %w", err)
+		}
+	}
+
+	return &fileCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		dir:      dir,
+	}, nil
+}
+
+// get returns the cached content for key and calls fetch if there is none.
+func (fc *fileCache) get(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	if content, ok := fc.fromMemory(key); ok {
+		fc.hits.Add(1)
+		return content, nil
+	}
+
+	content, err, _ := fc.group.Do(key, func() (interface{}, error) {
+		if content, ok := fc.fromMemory(key); ok {
+			fc.hits.Add(1)
+			return content, nil
+		}
+
+		if content, ok := fc.fromDisk(key); ok {
+			fc.diskHits.Add(1)
+			fc.toMemory(key, content)
+			return content, nil
+		}
+
+		fc.misses.Add(1)
+		content, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		fc.toMemory(key, content)
+		fc.toDisk(key, content)
+		return content, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return content.([]byte), nil
+}
+
+func (fc *fileCache) fromMemory(key string) ([]byte, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	e, ok := fc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	fc.lru.MoveToFront(e)
+	return e.Value.(*fileCacheEntry).content, true
+}
+
+// toMemory adds a file and evicts the least recently used ones until the
+// cache fits into maxBytes again, files larger than the cache are not kept.
+func (fc *fileCache) toMemory(key string, content []byte) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if _, ok := fc.entries[key]; ok || int64(len(content)) > fc.maxBytes {
+		return
+	}
+
+	fc.entries[key] = fc.lru.PushFront(&fileCacheEntry{key: key, content: content})
+	fc.size += int64(len(content))
+
+	for fc.size > fc.maxBytes {
+		oldest := fc.lru.Back()
+		entry := oldest.Value.(*fileCacheEntry)
+		fc.lru.Remove(oldest)
+		delete(fc.entries, entry.key)
+		fc.size -= int64(len(entry.content))
+	}
+}
+
+func (fc *fileCache) diskPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(fc.dir, hex.EncodeToString(sum[:]))
+}
+
+func (fc *fileCache) fromDisk(key string) ([]byte, bool) {
+	if fc.dir == "" {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(fc.diskPath(key))
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+// toDisk writes a file into the cache directory, failing to do so only costs
+// another API call on the next crawl so errors are ignored.
+func (fc *fileCache) toDisk(key string, content []byte) {
+	if fc.dir == "" {
+		return
+	}
+
+	tmp, err := os.CreateTemp(fc.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err != nil || closeErr != nil {
+		return
+	}
+
+	_ = os.Rename(tmp.Name(), fc.diskPath(key))
+}
+
+// logStats reports how many files were served from the cache.
+func (fc *fileCache) logStats(logger zerolog.Logger) {
+	hits, diskHits, misses := fc.hits.Load(), fc.diskHits.Load(), fc.misses.Load()
+
+	var hitRate float64
+	if total := hits + diskHits + misses; total > 0 {
+		hitRate = float64(hits+diskHits) / float64(total)
+	}
+
+	logger.Info().
+		Int64("Hits", hits).
+		Int64("DiskHits", diskHits).
+		Int64("Misses", misses).
+		Float64("HitRate", hitRate).
+		Msg("file cache statistics")
+}
+
+// getProjectFile reads a file of a project at the ref of source. Files of other
+// projects than the one whose pipeline is crawled are shared between pipelines,
+// their ref is resolved to a commit so they can be served from the file cache.
+func (c *Crawler) getProjectFile(ctx context.Context, source ciFileSource) ([]byte, error) {
+	fetch := func(ref string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			return c.gitlabClient.GetRawFileFromProject(ctx, source.project.ID, source.file, ref)
+		}
+	}
+
+	if source.project.ID == source.pipelineRoot().project.ID {
+		return fetch(source.ref)()
+	}
+
+	resolved, err := c.resolveRef(ctx, source.project.PathWithNamespace, source.ref)
+	if err != nil || resolved.sha == "" {
+		return fetch(source.ref)()
+	}
+
+	key := fmt.Sprintf("%d:%s@%s", source.project.ID, source.file, resolved.sha)
+	return c.fileCache.get(key, fetch(resolved.sha))
+}
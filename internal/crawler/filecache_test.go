@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fc, err := newFileCache(8, "")
+	assert.NoError(t, err)
+
+	fetches := 0
+	fetch := func(content string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			fetches++
+			return []byte(content), nil
+		}
+	}
+
+	_, _ = fc.get("a", fetch("aaaa"))
+	_, _ = fc.get("b", fetch("bbbb"))
+	_, _ = fc.get("a", fetch("aaaa"))
+	_, _ = fc.get("c", fetch("cccc"))
+	assert.Equal(t, 3, fetches)
+
+	// b was used least recently and had to make room for c.
+	_, _ = fc.get("a", fetch("aaaa"))
+	assert.Equal(t, 3, fetches)
+	_, _ = fc.get("b", fetch("bbbb"))
+	assert.Equal(t, 4, fetches)
+
+	assert.Equal(t, int64(2), fc.hits.Load())
+	assert.Equal(t, int64(4), fc.misses.Load())
+}
+
+func TestFileCacheSharesConcurrentFetches(t *testing.T) {
+	fc, err := newFileCache(1024, "")
+	assert.NoError(t, err)
+
+	var fetches atomic.Int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetch := func() ([]byte, error) {
+		if fetches.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("content"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := fc.get("key", fetch)
+			assert.NoError(t, err)
+			assert.Equal(t, "content", string(content))
+		}()
+	}
+
+	// Callers arriving after the fetch finished are served from memory,
+	// all others wait for the fetch in flight.
+	<-started
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(1), fetches.Load())
+}
+
+func TestFileCacheDisk(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := newFileCache(1024, dir)
+	assert.NoError(t, err)
+	_, err = first.get("key", func() ([]byte, error) { return []byte("content"), nil })
+	assert.NoError(t, err)
+
+	second, err := newFileCache(1024, dir)
+	assert.NoError(t, err)
+	content, err := second.get("key", func() ([]byte, error) { return nil, errors.New("should be read from disk") })
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	assert.Equal(t, int64(1), second.diskHits.Load())
+}
+
+func TestFileCacheDoesNotKeepErrors(t *testing.T) {
+	fc, err := newFileCache(1024, "")
+	assert.NoError(t, err)
+
+	_, err = fc.get("key", func() ([]byte, error) { return nil, errors.New("boom") })
+	assert.Error(t, err)
+
+	content, err := fc.get("key", func() ([]byte, error) { return []byte("content"), nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
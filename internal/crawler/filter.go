@@ -0,0 +1,200 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+const (
+	ProjectForksInclude         = "include"
+	ProjectForksExclude         = "exclude"
+	ProjectForksExcludePersonal = "exclude-personal"
+)
+
+var projectVisibilities = map[string]struct{}{
+	"public":   {},
+	"internal": {},
+	"private":  {},
+}
+
+// projectFilter decides which of the streamed projects are crawled. What the
+// projects API can filter on is sent along with the stream, everything else
+// is checked for every project.
+type projectFilter struct {
+	include       []*regexp.Regexp
+	exclude       []*regexp.Regexp
+	topics        []string
+	excludeTopics map[string]struct{}
+	visibilities  map[string]struct{}
+	skipArchived  bool
+	forks         string
+	membership    bool
+	owned         bool
+}
+
+func newProjectFilter(cfg *Config) (*projectFilter, error) {
+	f := &projectFilter{
+		topics:        cfg.ProjectTopics,
+		excludeTopics: make(map[string]struct{}, len(cfg.ProjectExcludeTopics)),
+		visibilities:  make(map[string]struct{}, len(cfg.ProjectVisibility)),
+		skipArchived:  cfg.ProjectSkipArchived,
+		forks:         cfg.ProjectForks,
+		membership:    cfg.ProjectMembership,
+		owned:         cfg.ProjectOwned,
+	}
+
+	var err error
+	if f.include, err = compilePathPatterns(cfg.ProjectInclude); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePathPatterns(cfg.ProjectExclude); err != nil {
+		return nil, err
+	}
+
+	for _, t := range cfg.ProjectExcludeTopics {
+		f.excludeTopics[t] = struct{}{}
+	}
+
+	for _, v := range cfg.ProjectVisibility {
+		if _, ok := projectVisibilities[v]; !ok {
+			return nil, fmt.Errorf("unknown project visibility: %s", v)
+		}
+		f.visibilities[v] = struct{}{}
+	}
+
+	switch f.forks {
+	case "", ProjectForksInclude, ProjectForksExclude, ProjectForksExcludePersonal:
+	default:
+		return nil, fmt.Errorf("unknown fork selection: %s", f.forks)
+	}
+
+	return f, nil
+}
+
+func compilePathPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compilePathPattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// compilePathPattern turns a pattern for the path of a project into a regular
+// expression. Patterns enclosed in slashes are regular expressions already,
+// all others are globs where `*` stays within a group and `**` does not.
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// streamFilter returns the part of the filter the projects API applies itself.
+// The API only takes a single visibility, more of them are filtered by skip.
+func (f *projectFilter) streamFilter() gitlab.ProjectFilter {
+	sf := gitlab.ProjectFilter{
+		Topics:     f.topics,
+		Membership: f.membership,
+		Owned:      f.owned,
+	}
+
+	if f.skipArchived {
+		archived := false
+		sf.Archived = &archived
+	}
+
+	if len(f.visibilities) == 1 {
+		for v := range f.visibilities {
+			sf.Visibility = v
+		}
+	}
+
+	return sf
+}
+
+// skip returns why a project is not crawled, or an empty string if it is.
+// Server-side filters that can be told from the project are checked again,
+// a resumed stream continues at a page URL that was built before the filters
+// might have changed. Membership and ownership are not part of a project, so
+// they only apply to a fresh stream. Projects that a filter skips are not
+// removed from the graph, their edges of earlier crawls stay.
+func (f *projectFilter) skip(p gitlab.Project) string {
+	if len(f.include) > 0 && !matchesAny(f.include, p.PathWithNamespace) {
+		return "path not included"
+	}
+
+	if matchesAny(f.exclude, p.PathWithNamespace) {
+		return "path excluded"
+	}
+
+	if f.skipArchived && p.Archived {
+		return "archived"
+	}
+
+	if len(f.visibilities) > 0 {
+		if _, ok := f.visibilities[p.Visibility]; !ok {
+			return "visibility " + p.Visibility
+		}
+	}
+
+	topics := make(map[string]struct{}, len(p.Topics))
+	for _, t := range p.Topics {
+		if _, ok := f.excludeTopics[t]; ok {
+			return "topic " + t + " excluded"
+		}
+		topics[t] = struct{}{}
+	}
+
+	for _, t := range f.topics {
+		if _, ok := topics[t]; !ok {
+			return "topic " + t + " missing"
+		}
+	}
+
+	if p.ForkedFromProject != nil {
+		switch {
+		case f.forks == ProjectForksExclude:
+			return "fork"
+		case f.forks == ProjectForksExcludePersonal && p.Namespace.Kind == gitlab.NamespaceKindUser:
+			return "personal fork"
+		}
+	}
+
+	return ""
+}
+
+func matchesAny(patterns []*regexp.Regexp, path string) bool {
+	for _, re := range patterns {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePathPattern(t *testing.T) {
+	testData := []struct {
+		Pattern string
+		Path    string
+		Match   bool
+	}{
+		{Pattern: "team/*", Path: "team/app", Match: true},
+		{Pattern: "team/*", Path: "team/sub/app", Match: false},
+		{Pattern: "team/**", Path: "team/sub/app", Match: true},
+		{Pattern: "team/app-?", Path: "team/app-1", Match: true},
+		{Pattern: "team/app.js", Path: "team/appxjs", Match: false},
+		{Pattern: "**/sandbox-*", Path: "platform/tools/sandbox-ci", Match: true},
+		{Pattern: "/^(team|platform)/.*-ci$/", Path: "platform/tools/templates-ci", Match: true},
+		{Pattern: "/^(team|platform)/.*-ci$/", Path: "other/templates-ci", Match: false},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Pattern+"_"+td.Path, func(t *testing.T) {
+			re, err := compilePathPattern(td.Pattern)
+			assert.NoError(t, err)
+			assert.Equal(t, td.Match, re.MatchString(td.Path))
+		})
+	}
+}
+
+func TestProjectFilterSkip(t *testing.T) {
+	filter, err := newProjectFilter(&Config{
+		ProjectInclude:       []string{"team/**", "platform/*"},
+		ProjectExclude:       []string{"team/archive/**"},
+		ProjectTopics:        []string{"ci"},
+		ProjectExcludeTopics: []string{"deprecated"},
+		ProjectVisibility:    []string{"internal", "private"},
+		ProjectSkipArchived:  true,
+		ProjectForks:         ProjectForksExcludePersonal,
+	})
+	assert.NoError(t, err)
+
+	base := gitlab.Project{
+		PathWithNamespace: "team/app",
+		Visibility:        "internal",
+		Topics:            []string{"ci", "go"},
+		Namespace:         gitlab.Namespace{Kind: gitlab.NamespaceKindGroup},
+	}
+
+	testData := []struct {
+		Name    string
+		Modify  func(p *gitlab.Project)
+		Skipped bool
+	}{
+		{Name: "Crawled", Modify: func(p *gitlab.Project) {}},
+		{Name: "NotIncluded", Modify: func(p *gitlab.Project) { p.PathWithNamespace = "other/app" }, Skipped: true},
+		{Name: "Excluded", Modify: func(p *gitlab.Project) { p.PathWithNamespace = "team/archive/app" }, Skipped: true},
+		{Name: "Archived", Modify: func(p *gitlab.Project) { p.Archived = true }, Skipped: true},
+		{Name: "Public", Modify: func(p *gitlab.Project) { p.Visibility = "public" }, Skipped: true},
+		{Name: "MissingTopic", Modify: func(p *gitlab.Project) { p.Topics = []string{"go"} }, Skipped: true},
+		{Name: "ExcludedTopic", Modify: func(p *gitlab.Project) { p.Topics = append(p.Topics, "deprecated") }, Skipped: true},
+		{Name: "GroupFork", Modify: func(p *gitlab.Project) { p.ForkedFromProject = &gitlab.Project{ID: 1} }},
+		{Name: "PersonalFork", Modify: func(p *gitlab.Project) {
+			p.ForkedFromProject = &gitlab.Project{ID: 1}
+			p.Namespace.Kind = gitlab.NamespaceKindUser
+		}, Skipped: true},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			p := base
+			p.Topics = append([]string(nil), base.Topics...)
+			td.Modify(&p)
+			assert.Equal(t, td.Skipped, filter.skip(p) != "")
+		})
+	}
+}
+
+func TestProjectFilterStreamFilter(t *testing.T) {
+	filter, err := newProjectFilter(&Config{
+		ProjectTopics:       []string{"ci"},
+		ProjectVisibility:   []string{"internal"},
+		ProjectSkipArchived: true,
+		ProjectMembership:   true,
+	})
+	assert.NoError(t, err)
+
+	archived := false
+	assert.Equal(t, gitlab.ProjectFilter{
+		Archived:   &archived,
+		Visibility: "internal",
+		Topics:     []string{"ci"},
+		Membership: true,
+	}, filter.streamFilter())
+
+	_, err = newProjectFilter(&Config{ProjectVisibility: []string{"secret"}})
+	assert.Error(t, err)
+
+	_, err = newProjectFilter(&Config{ProjectForks: "some"})
+	assert.Error(t, err)
+
+	_, err = newProjectFilter(&Config{ProjectInclude: []string{"/(/"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+// isLocalGlob reports whether a local include uses wildcards.
+func isLocalGlob(localPath string) bool {
+	return strings.Contains(localPath, "*")
+}
+
+// compileLocalGlob turns the wildcard path of an `include:local` into a regular
+// expression using the same rules as GitLab: `**` matches anything including
+// `/` and `*` matches anything but `/`.
+// See https://docs.gitlab.com/ee/ci/yaml/includes.html#use-includelocal-with-wildcard-file-paths
+func compileLocalGlob(pattern string) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(strings.TrimPrefix(pattern, "/"))
+	quoted = strings.ReplaceAll(quoted, `\*\*`, `.*?`)
+	quoted = strings.ReplaceAll(quoted, `\*`, `[^/]*?`)
+
+	return regexp.Compile("^" + quoted + "$")
+}
+
+// globDir returns the deepest directory of a pattern that does not contain
+// any wildcards, the repository tree only has to be listed below it.
+func globDir(pattern string) string {
+	static, _, _ := strings.Cut(strings.TrimPrefix(pattern, "/"), "*")
+	dir := path.Dir(static + "x")
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// expandLocalGlob lists the repository of the project and returns all files
+// matching the wildcard path of a local include.
+func (c *Crawler) expandLocalGlob(ctx context.Context, project gitlab.Project, pattern, ref string) ([]string, error) {
+	re, err := compileLocalGlob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile local include pattern %s: %w", pattern, err)
+	}
+
+	files, err := c.gitlabClient.ListRepositoryFiles(ctx, project.ID, globDir(pattern), ref)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]string, 0)
+	for _, f := range files {
+		if re.MatchString(f) {
+			matches = append(matches, f)
+		}
+	}
+
+	return matches, nil
+}
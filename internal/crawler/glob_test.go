@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileLocalGlob(t *testing.T) {
+	files := []string{
+		"ci/build.yml",
+		"ci/test.yml",
+		"ci/jobs/lint.yml",
+		"ci/jobs/deploy/prod.yml",
+		"ci/README.md",
+		"other/build.yml",
+	}
+
+	testData := []struct {
+		Name    string
+		Pattern string
+		Dir     string
+		Out     []string
+	}{
+		{
+			Name:    "SingleLevel",
+			Pattern: "ci/*.yml",
+			Dir:     "ci",
+			Out:     []string{"ci/build.yml", "ci/test.yml"},
+		},
+		{
+			Name:    "AllLevels",
+			Pattern: "/ci/**.yml",
+			Dir:     "ci",
+			Out:     []string{"ci/build.yml", "ci/test.yml", "ci/jobs/lint.yml", "ci/jobs/deploy/prod.yml"},
+		},
+		{
+			Name:    "OnlySubfolders",
+			Pattern: "ci/**/*.yml",
+			Dir:     "ci",
+			Out:     []string{"ci/jobs/lint.yml", "ci/jobs/deploy/prod.yml"},
+		},
+		{
+			Name:    "WildcardDirectory",
+			Pattern: "*/build.yml",
+			Dir:     "",
+			Out:     []string{"ci/build.yml", "other/build.yml"},
+		},
+		{
+			Name:    "PartialDirectory",
+			Pattern: "ci/jo*/lint.yml",
+			Dir:     "ci",
+			Out:     []string{"ci/jobs/lint.yml"},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			re, err := compileLocalGlob(td.Pattern)
+			if err != nil {
+				t.Fatalf("failed to compile pattern: %s", err)
+			}
+
+			matches := make([]string, 0)
+			for _, f := range files {
+				if re.MatchString(f) {
+					matches = append(matches, f)
+				}
+			}
+
+			assert.Equal(t, td.Out, matches)
+			assert.Equal(t, td.Dir, globDir(td.Pattern))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+// resolveGroups looks up the groups a crawl is limited to. Groups nested in
+// another one of them are dropped, their projects are streamed with the parent.
+func (c *Crawler) resolveGroups(ctx context.Context, names []string) ([]gitlab.Group, error) {
+	groups := make([]gitlab.Group, 0, len(names))
+	for _, name := range names {
+		g, err := c.gitlabClient.GetGroup(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].FullPath < groups[j].FullPath
+	})
+
+	scoped := make([]gitlab.Group, 0, len(groups))
+	for _, g := range groups {
+		if len(scoped) > 0 && inGroup(scoped[len(scoped)-1], g.FullPath) {
+			continue
+		}
+		scoped = append(scoped, g)
+	}
+
+	return scoped, nil
+}
+
+// streamProjects streams the projects of every group one after the other, or
+// all projects of the instance without groups. A resumed crawl skips the
+// groups before the one its start URL belongs to.
+func (c *Crawler) streamProjects(ctx context.Context, opts gitlab.StreamOptions, projects chan<- gitlab.Project) error {
+	if len(c.groups) == 0 {
+		return c.gitlabClient.StreamAllProjects(ctx, opts, projects)
+	}
+
+	groups := c.groups
+	if opts.StartURL != "" {
+		i, err := groupOfPage(groups, opts.StartURL)
+		if err != nil {
+			return err
+		}
+		groups = groups[i:]
+	}
+
+	for i, g := range groups {
+		groupOpts := opts
+		groupOpts.Group = g.ID
+		if i > 0 {
+			groupOpts.StartURL = ""
+		}
+
+		c.logger.Info().
+			Str("Group", g.FullPath).
+			Msg("streaming projects of group")
+
+		if err := c.gitlabClient.StreamAllProjects(ctx, groupOpts, projects); err != nil {
+			return fmt.Errorf("failed to stream projects of group %s: %w", g.FullPath, err)
+		}
+	}
+
+	return nil
+}
+
+// groupOfPage finds the group a page URL of the group projects API belongs to.
+func groupOfPage(groups []gitlab.Group, pageURL string) (int, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse page URL %s: %w", pageURL, err)
+	}
+
+	for i, g := range groups {
+		if strings.HasSuffix(u.Path, "/groups/"+strconv.Itoa(g.ID)+"/projects") {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("page %s does not belong to any of the crawled groups", pageURL)
+}
+
+// inScope tells if a project belongs to the groups the crawl is limited to.
+// The token of a group-scoped crawl may not see projects outside of them,
+// so failing to look those up does not mean they are missing.
+func (c *Crawler) inScope(project string) bool {
+	if len(c.groups) == 0 {
+		return true
+	}
+
+	for _, g := range c.groups {
+		if inGroup(g, project) {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroup tells if path is the group itself or lives anywhere below it,
+// paths are compared case-insensitively like GitLab does.
+func inGroup(g gitlab.Group, path string) bool {
+	group, path := strings.ToLower(g.FullPath), strings.ToLower(path)
+	return path == group || strings.HasPrefix(path, group+"/")
+}
@@ -0,0 +1,152 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerStreamProjectsOfGroups(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/version":                 `{"version":"17.0.0"}`,
+		"/api/v4/groups/platform":         `{"id":10,"full_path":"platform"}`,
+		"/api/v4/groups/platform%2Ftools": `{"id":11,"full_path":"platform/tools"}`,
+		"/api/v4/groups/team":             `{"id":20,"full_path":"team"}`,
+		"/api/v4/groups/10/projects":      `[{"id":5,"path_with_namespace":"platform/ci"},{"id":9,"path_with_namespace":"platform/tools/lint"}]`,
+		"/api/v4/groups/20/projects":      `[{"id":3,"path_with_namespace":"team/app"},{"id":7,"path_with_namespace":"team/api"}]`,
+	}
+
+	var requested []string
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(r.URL.Path, "/projects") {
+				assert.Equal(t, "true", r.URL.Query().Get("include_subgroups"))
+				requested = append(requested, r.URL.EscapedPath())
+			}
+
+			body, ok := responses[r.URL.EscapedPath()]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	crawler.groups, err = crawler.resolveGroups(context.TODO(), []string{"team", "platform/tools", "platform"})
+	assert.NoError(t, err)
+	assert.Equal(t, []gitlab.Group{{ID: 10, FullPath: "platform"}, {ID: 20, FullPath: "team"}}, crawler.groups)
+
+	streamed := func(opts gitlab.StreamOptions) []int {
+		projects := make(chan gitlab.Project, 10)
+		assert.NoError(t, crawler.streamProjects(context.TODO(), opts, projects))
+		close(projects)
+
+		ids := make([]int, 0)
+		for p := range projects {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int{5, 9, 3, 7}, streamed(gitlab.StreamOptions{PageSize: 100}))
+	assert.Equal(t, []string{"/api/v4/groups/10/projects", "/api/v4/groups/20/projects"}, requested)
+
+	// Resuming in the second group skips the first one and the projects
+	// of the checkpoint page that were done already.
+	requested = nil
+	assert.Equal(t, []int{7}, streamed(gitlab.StreamOptions{
+		PageSize:     100,
+		StartURL:     "https://gitlab.example.com/api/v4/groups/20/projects?include_subgroups=true",
+		StartAfterID: 3,
+	}))
+	assert.Equal(t, []string{"/api/v4/groups/20/projects"}, requested)
+
+	projects := make(chan gitlab.Project, 10)
+	err = crawler.streamProjects(context.TODO(), gitlab.StreamOptions{StartURL: "https://gitlab.example.com/api/v4/groups/99/projects"}, projects)
+	assert.Error(t, err)
+}
+
+func TestCrawlerStreamProjectsOfGroupPages(t *testing.T) {
+	const pages = "https://gitlab.example.com/api/v4/groups/10/projects?include_subgroups=true&page="
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			body := `{"id":10,"full_path":"platform"}`
+
+			switch r.URL.Path {
+			case "/api/v4/version":
+				body = `{"version":"17.0.0"}`
+			case "/api/v4/groups/10/projects":
+				// Offset pagination links every page, the last one has no next link.
+				switch r.URL.Query().Get("page") {
+				case "2":
+					header.Set("Link", `<`+pages+`1>; rel="prev", <`+pages+`1>; rel="first", <`+pages+`2>; rel="last"`)
+					body = `[{"id":9,"path_with_namespace":"platform/tools/lint"}]`
+				default:
+					header.Set("Link", `<`+pages+`2>; rel="next", <`+pages+`1>; rel="first", <`+pages+`2>; rel="last"`)
+					body = `[{"id":5,"path_with_namespace":"platform/ci"}]`
+				}
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+	crawler.groups = []gitlab.Group{{ID: 10, FullPath: "platform"}}
+
+	projects := make(chan gitlab.Project, 10)
+	assert.NoError(t, crawler.streamProjects(context.TODO(), gitlab.StreamOptions{PageSize: 1}, projects))
+	close(projects)
+
+	ids := make([]int, 0)
+	for p := range projects {
+		ids = append(ids, p.ID)
+	}
+	assert.Equal(t, []int{5, 9}, ids)
+}
+
+func TestCrawlerInScope(t *testing.T) {
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	assert.True(t, crawler.inScope("anything/at/all"))
+
+	crawler.groups = []gitlab.Group{{ID: 10, FullPath: "platform"}}
+	assert.True(t, crawler.inScope("platform/ci"))
+	assert.True(t, crawler.inScope("Platform/Tools/Lint"))
+	assert.False(t, crawler.inScope("platform-legacy/ci"))
+	assert.False(t, crawler.inScope("team/app"))
+
+	// Projects outside of the crawled groups are not marked as missing.
+	assert.NoError(t, crawler.handleMissingProject(context.TODO(), "team/app", gitlab.ErrProjectForbidden))
+}
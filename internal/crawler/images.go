@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+const defaultImageRegistry = "docker.io"
+
+// ImageUsage is an `image:` or an entry of `services:` found in a CI file.
+// Job is empty for images set in `default:` or at the top level of the file,
+// those are used by every job of the pipeline that does not set its own.
+// See https://docs.gitlab.com/ee/ci/yaml/#image
+type ImageUsage struct {
+	Job        string
+	Name       string
+	Service    bool
+	Alias      string
+	Entrypoint []string
+	PullPolicy []string
+}
+
+// parseImages reads the images and services of every job of a CI file together
+// with the ones of `default:` and the deprecated top-level keywords.
+func (c *Crawler) parseImages(parsed map[string]interface{}) []ImageUsage {
+	images := imagesOf("", parsed)
+	if d, ok := parsed["default"].(map[string]interface{}); ok {
+		images = append(images, imagesOf("", d)...)
+	}
+
+	for rawJob := range parsed {
+		if _, isKeyword := globalKeywords[rawJob]; isKeyword {
+			continue
+		}
+
+		job, isMap := parsed[rawJob].(map[string]interface{})
+		if !isMap {
+			continue
+		}
+
+		images = append(images, imagesOf(rawJob, job)...)
+	}
+
+	return images
+}
+
+// imagesOf returns the `image:` and `services:` of a single job or `default:` block,
+// both accept a plain image name or a map with the name and its options.
+func imagesOf(job string, block map[string]interface{}) []ImageUsage {
+	images := make([]ImageUsage, 0)
+
+	if image, ok := parseImageUsage(job, block["image"]); ok {
+		images = append(images, image)
+	}
+
+	services, _ := block["services"].([]interface{})
+	for _, s := range services {
+		if service, ok := parseImageUsage(job, s); ok {
+			service.Service = true
+			images = append(images, service)
+		}
+	}
+
+	return images
+}
+
+func parseImageUsage(job string, raw interface{}) (ImageUsage, bool) {
+	switch i := raw.(type) {
+	case string:
+		return ImageUsage{Job: job, Name: i}, i != ""
+	case map[string]interface{}:
+		image := ImageUsage{
+			Job:        job,
+			Name:       extractFieldFromMap("name", i),
+			Alias:      extractFieldFromMap("alias", i),
+			Entrypoint: stringList(i["entrypoint"]),
+			PullPolicy: stringList(i["pull_policy"]),
+		}
+		return image, image.Name != ""
+	}
+	return ImageUsage{}, false
+}
+
+// stringList reads a value that is either a single string or a list of strings.
+func stringList(raw interface{}) []string {
+	switch v := raw.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			list = append(list, fmt.Sprint(s))
+		}
+		return list
+	}
+	return nil
+}
+
+// parseImageReference splits an image name into its registry, repository, tag and
+// digest the way Docker does: images without a registry come from Docker Hub, official
+// images live in its `library/` namespace and images without a tag or digest use `latest`.
+func parseImageReference(name string) storage.Image {
+	var image storage.Image
+
+	name, image.Digest, _ = strings.Cut(name, "@")
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, image.Tag = name[:i], name[i+1:]
+	}
+
+	registry, repository, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		image.Registry = strings.ToLower(registry)
+		image.Repository = repository
+	} else {
+		image.Registry = defaultImageRegistry
+		image.Repository = name
+	}
+
+	if image.Registry == defaultImageRegistry && !strings.Contains(image.Repository, "/") {
+		image.Repository = "library/" + image.Repository
+	}
+
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = "latest"
+	}
+
+	return image
+}
+
+// handleImages stores a USES_IMAGE edge from the project a pipeline belongs to
+// to every image the file uses, images of included files are attributed to the
+// project including them. Images whose name still contains variables are kept
+// as they are since they cannot be split into their parts.
+func (c *Crawler) handleImages(ctx context.Context, source ciFileSource, images []ImageUsage) error {
+	pipeline := source.pipelineRoot()
+	_, fileID := source.fileNode()
+
+	for _, i := range images {
+		name, resolved := source.variables.expand(i.Name)
+
+		image := storage.Image{Repository: name}
+		if resolved {
+			image = parseImageReference(name)
+		}
+
+		if err := c.storage.CreateImageNode(ctx, image); err != nil {
+			return fmt.Errorf("failed to write image to storage: %w", err)
+		}
+
+		if err := c.storage.CreateUsesImageEdge(ctx, storage.Edge{
+			SourceType:    pipeline.nodeType,
+			SourceProject: pipeline.name,
+			SourceRef:     pipeline.ref,
+			Pipeline:      source.pipeline(),
+			TargetType:    storage.NodeTypeImage,
+			TargetProject: storage.ImageID(image),
+			Unresolved:    !resolved,
+			Properties: map[string]interface{}{
+				"job":         i.Job,
+				"file":        fileID,
+				"service":     i.Service,
+				"default":     i.Job == "",
+				"alias":       i.Alias,
+				"entrypoint":  i.Entrypoint,
+				"pull_policy": i.PullPolicy,
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to write uses image edge: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerParseImages(t *testing.T) {
+	testFile, err := os.ReadFile("../../test-files/gitlab-ci-images.yaml")
+	if err != nil {
+		t.Fatal("cannot find test file")
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	parsed, err := crawler.UnmarshalCIFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to parse images: %s", err)
+	}
+	images := crawler.parseImages(parsed)
+
+	expectedImages := []ImageUsage{
+		{Name: "ruby:3.2"},
+		{
+			Name:       "registry.example.com/base/ci:1.4@sha256:0123456789abcdef",
+			PullPolicy: []string{"always", "if-not-present"},
+		},
+		{Name: "postgres:15", Service: true},
+		{Job: "build", Name: "golang"},
+		{Job: "test", Name: "$CI_REGISTRY_IMAGE/test", Entrypoint: []string{""}},
+		{Job: "test", Name: "localhost:5000/redis", Service: true, Alias: "cache", PullPolicy: []string{"always"}},
+	}
+
+	assert.ElementsMatch(t, expectedImages, images)
+}
+
+func TestParseImageReference(t *testing.T) {
+	testData := []struct {
+		Name     string
+		Expected storage.Image
+	}{
+		{
+			Name:     "golang",
+			Expected: storage.Image{Registry: "docker.io", Repository: "library/golang", Tag: "latest"},
+		},
+		{
+			Name:     "ruby:3.2",
+			Expected: storage.Image{Registry: "docker.io", Repository: "library/ruby", Tag: "3.2"},
+		},
+		{
+			Name:     "bitnami/redis:7.0",
+			Expected: storage.Image{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.0"},
+		},
+		{
+			Name:     "Registry.Example.com/base/ci:1.4@sha256:0123456789abcdef",
+			Expected: storage.Image{Registry: "registry.example.com", Repository: "base/ci", Tag: "1.4", Digest: "sha256:0123456789abcdef"},
+		},
+		{
+			Name:     "localhost:5000/redis",
+			Expected: storage.Image{Registry: "localhost:5000", Repository: "redis", Tag: "latest"},
+		},
+		{
+			Name:     "alpine@sha256:0123456789abcdef",
+			Expected: storage.Image{Registry: "docker.io", Repository: "library/alpine", Digest: "sha256:0123456789abcdef"},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			assert.Equal(t, td.Expected, parseImageReference(td.Name))
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// globalKeywords are the top-level keys of a CI file that are not jobs,
+// see https://docs.gitlab.com/ee/ci/yaml/#global-keywords
+var globalKeywords = map[string]struct{}{
+	"default":       {},
+	"include":       {},
+	"stages":        {},
+	"variables":     {},
+	"workflow":      {},
+	"spec":          {},
+	"image":         {},
+	"services":      {},
+	"cache":         {},
+	"before_script": {},
+	"after_script":  {},
+	"types":         {},
+}
+
+// Job is a single job of a CI file, hidden jobs starting with `.` included.
+type Job struct {
+	Name       string
+	Extends    []string
+	References []JobReference
+}
+
+// JobReference is a `!reference [.job, key, ...]` tag pointing into another job.
+type JobReference struct {
+	Job  string
+	Path []string
+}
+
+// parseJobs reads all jobs of a CI file together with the jobs they use through
+// `extends:` and `!reference` tags. The documents are read as yaml.Node since
+// the `!reference` tag is lost when decoding into plain maps.
+func (c *Crawler) parseJobs(documents []*yaml.Node) []Job {
+	jobs := make([]Job, 0)
+
+	for _, document := range documents {
+		if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		root := document.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, value := root.Content[i], root.Content[i+1]
+			if _, isKeyword := globalKeywords[key.Value]; isKeyword || value.Kind != yaml.MappingNode {
+				continue
+			}
+
+			job := Job{Name: key.Value}
+
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if value.Content[j].Value != "extends" {
+					continue
+				}
+
+				var extends StringArray
+				if err := value.Content[j+1].Decode(&extends); err != nil {
+					c.logger.Debug().
+						Err(err).
+						Str("Job", job.Name).
+						Msg("failed to parse extends of job")
+					continue
+				}
+				job.Extends = extends
+			}
+
+			job.References = findReferences(value)
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
+
+// findReferences walks a node and collects all `!reference` tags inside of it.
+func findReferences(node *yaml.Node) []JobReference {
+	var references []JobReference
+
+	if node.Tag == "!reference" && node.Kind == yaml.SequenceNode && len(node.Content) > 0 {
+		ref := JobReference{Job: node.Content[0].Value}
+		for _, p := range node.Content[1:] {
+			ref.Path = append(ref.Path, p.Value)
+		}
+		return append(references, ref)
+	}
+
+	for _, child := range node.Content {
+		references = append(references, findReferences(child)...)
+	}
+
+	return references
+}
+
+// jobDefinition is a job together with the file it is defined in.
+type jobDefinition struct {
+	job      Job
+	fileType storage.NodeType
+	fileID   string
+}
+
+func (jd jobDefinition) id() string {
+	return storage.JobID(jd.fileID, jd.job.Name)
+}
+
+// jobIndex collects the jobs of all files of one pipeline in the order GitLab
+// merges them: the includes of a file come before the file itself, so a
+// later definition of a job overrides an earlier one.
+type jobIndex struct {
+	definitions []jobDefinition
+}
+
+func (ji *jobIndex) add(source ciFileSource, jobs []Job) {
+	if ji == nil {
+		return
+	}
+
+	fileType, fileID := source.fileNode()
+	for _, j := range jobs {
+		ji.definitions = append(ji.definitions, jobDefinition{
+			job:      j,
+			fileType: fileType,
+			fileID:   fileID,
+		})
+	}
+}
+
+// resolve returns the definition every job name ends up with in the merged pipeline.
+func (ji *jobIndex) resolve() map[string]jobDefinition {
+	resolved := make(map[string]jobDefinition, len(ji.definitions))
+	for _, d := range ji.definitions {
+		resolved[d.job.Name] = d
+	}
+	return resolved
+}
+
+// storeJobs writes all jobs of a pipeline and resolves their `extends:` and
+// `!reference` usages against the merged pipeline, since GitLab merges all
+// included files before resolving them a job can use jobs from any file.
+func (c *Crawler) storeJobs(ctx context.Context, pipeline string, index *jobIndex) error {
+	resolved := index.resolve()
+
+	for _, d := range index.definitions {
+		if err := c.storage.CreateJobNode(ctx, storage.Job{
+			Name:     d.job.Name,
+			FileType: d.fileType,
+			FileID:   d.fileID,
+		}); err != nil {
+			return fmt.Errorf("failed to write job to storage: %w", err)
+		}
+	}
+
+	for _, d := range index.definitions {
+		for _, e := range d.job.Extends {
+			target, ok := resolved[e]
+			if !ok {
+				c.logger.Debug().
+					Str("Job", d.job.Name).
+					Str("File", d.fileID).
+					Str("Extends", e).
+					Msg("could not resolve extended job")
+				continue
+			}
+
+			if err := c.storage.CreateExtendsEdge(ctx, storage.Edge{
+				SourceType:    storage.NodeTypeJob,
+				SourceProject: d.id(),
+				TargetType:    storage.NodeTypeJob,
+				TargetProject: target.id(),
+				Pipeline:      pipeline,
+			}); err != nil {
+				return fmt.Errorf("failed to write extends edge: %w", err)
+			}
+		}
+
+		for _, r := range d.job.References {
+			target, ok := resolved[r.Job]
+			if !ok {
+				c.logger.Debug().
+					Str("Job", d.job.Name).
+					Str("File", d.fileID).
+					Str("Reference", r.Job).
+					Msg("could not resolve referenced job")
+				continue
+			}
+
+			if err := c.storage.CreateReferenceEdge(ctx, storage.Edge{
+				SourceType:    storage.NodeTypeJob,
+				SourceProject: d.id(),
+				TargetType:    storage.NodeTypeJob,
+				TargetProject: target.id(),
+				Pipeline:      pipeline,
+				Properties: map[string]interface{}{
+					"path": r.Path,
+				},
+			}); err != nil {
+				return fmt.Errorf("failed to write reference edge: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
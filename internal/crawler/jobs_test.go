@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerParseJobs(t *testing.T) {
+	testFile, err := os.ReadFile("../../test-files/gitlab-ci-jobs.yaml")
+	if err != nil {
+		t.Fatal("cannot find test file")
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	documents, err := decodeCIFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to parse jobs: %s", err)
+	}
+	jobs := crawler.parseJobs(documents)
+
+	expectedJobs := []Job{
+		{Name: ".build-base"},
+		{
+			Name:       "build",
+			Extends:    []string{".build-base"},
+			References: []JobReference{{Job: ".setup", Path: []string{"script"}}},
+		},
+		{
+			Name:       "test",
+			Extends:    []string{".build-base", ".cache"},
+			References: []JobReference{{Job: ".setup", Path: []string{"before_script"}}},
+		},
+	}
+
+	assert.Equal(t, expectedJobs, jobs)
+}
+
+func TestJobIndexResolve(t *testing.T) {
+	consumer := projectSource(gitlab.Project{PathWithNamespace: "my-group/project", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	template := projectSource(gitlab.Project{PathWithNamespace: "platform/ci", DefaultBranch: "main"}, "templates/build.yml", nil)
+	template.ref = "v1.4.0"
+
+	index := &jobIndex{}
+	// includes are added before the file including them
+	index.add(template, []Job{{Name: ".build-base"}, {Name: ".setup"}})
+	index.add(consumer, []Job{{Name: ".build-base"}, {Name: "build", Extends: []string{".build-base"}}})
+
+	resolved := index.resolve()
+
+	assert.Equal(t, "my-group/project:.gitlab-ci.yml@main#.build-base", resolved[".build-base"].id())
+	assert.Equal(t, "platform/ci:templates/build.yml@v1.4.0#.setup", resolved[".setup"].id())
+	assert.Len(t, index.definitions, 4)
+}
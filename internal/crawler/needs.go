@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// parentPipelineIDVariable is used by child pipelines to fetch artifacts
+// from their parent pipeline, it never points to another project.
+const parentPipelineIDVariable = "$PARENT_PIPELINE_ID"
+
+// CrossProjectNeed is an entry of `needs:` that couples a job to another project,
+// either through `needs:project` to fetch artifacts of a job in the other project
+// or through `needs:pipeline` to mirror the status of the other project's pipeline.
+// See https://docs.gitlab.com/ee/ci/yaml/#needsproject
+type CrossProjectNeed struct {
+	SourceJob string
+	Project   string
+	Job       string
+	Ref       string
+	Artifacts bool
+	Pipeline  bool
+	// Unresolved is set when variables in the need could not be expanded.
+	Unresolved bool
+}
+
+func (c *Crawler) parseNeeds(parsed map[string]interface{}) []CrossProjectNeed {
+	needs := make([]CrossProjectNeed, 0)
+	for rawJob := range parsed {
+		if _, isKeyword := globalKeywords[rawJob]; isKeyword {
+			continue
+		}
+
+		job, isMap := parsed[rawJob].(map[string]interface{})
+		if !isMap {
+			continue
+		}
+
+		rawNeeds, ok := job["needs"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, rawNeed := range rawNeeds {
+			need, ok := rawNeed.(map[string]interface{})
+			if !ok {
+				// plain job names point to jobs in the same pipeline
+				continue
+			}
+
+			if project := extractFieldFromMap("project", need); project != "" {
+				artifacts, hasArtifacts := need["artifacts"].(bool)
+				needs = append(needs, CrossProjectNeed{
+					SourceJob: rawJob,
+					Project:   project,
+					Job:       extractFieldFromMap("job", need),
+					Ref:       extractFieldFromMap("ref", need),
+					Artifacts: artifacts || !hasArtifacts,
+				})
+				continue
+			}
+
+			pipeline := extractFieldFromMap("pipeline", need)
+			if pipeline == "" || pipeline == parentPipelineIDVariable {
+				continue
+			}
+
+			needs = append(needs, CrossProjectNeed{
+				SourceJob: rawJob,
+				Project:   pipeline,
+				Pipeline:  true,
+			})
+		}
+	}
+
+	return needs
+}
+
+// expandNeeds expands the variables in the project and ref of the needs.
+func (c *Crawler) expandNeeds(needs []CrossProjectNeed, vars *ciVariables) []CrossProjectNeed {
+	expanded := make([]CrossProjectNeed, len(needs))
+	for i, n := range needs {
+		var projectOK, refOK bool
+		n.Project, projectOK = vars.expand(n.Project)
+		n.Ref, refOK = vars.expand(n.Ref)
+		n.Unresolved = !projectOK || !refOK
+		expanded[i] = n
+	}
+	return expanded
+}
+
+// handleNeeds stores a NEEDS_ARTIFACTS edge for every cross project need of a file.
+func (c *Crawler) handleNeeds(ctx context.Context, source ciFileSource, needs []CrossProjectNeed) error {
+	for _, n := range c.expandNeeds(needs, source.variables) {
+		if n.Ref == "" && !n.Pipeline {
+			n.Ref = c.config.DefaultRefName
+		}
+
+		targetType, err := c.createProjectTarget(ctx, n.Project)
+		if err != nil {
+			return err
+		}
+
+		if err := c.storage.CreateNeedsArtifactsEdge(ctx, storage.Edge{
+			SourceType:    source.nodeType,
+			SourceProject: source.name,
+			SourceRef:     source.ref,
+			Pipeline:      source.pipeline(),
+			TargetType:    targetType,
+			TargetProject: n.Project,
+			Ref:           n.Ref,
+			Unresolved:    n.Unresolved,
+			Properties: map[string]interface{}{
+				"source_job": n.SourceJob,
+				"job":        n.Job,
+				"artifacts":  n.Artifacts,
+				"pipeline":   n.Pipeline,
+			},
+		}); err != nil {
+			return fmt.Errorf("failed to write needs edge: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerParseNeeds(t *testing.T) {
+	testFile, err := os.ReadFile("../../test-files/gitlab-ci-needs.yaml")
+	if err != nil {
+		t.Fatal("cannot find test file")
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	parsed, err := crawler.UnmarshalCIFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to parse needs: %s", err)
+	}
+	needs := crawler.parseNeeds(parsed)
+
+	expectedNeeds := []CrossProjectNeed{
+		{SourceJob: "build", Project: "group/lib", Job: "build", Ref: "main", Artifacts: true},
+		{SourceJob: "package", Project: "$UPSTREAM_PROJECT", Job: "compile", Ref: "$CI_COMMIT_REF_NAME", Artifacts: false},
+		{SourceJob: "mirror", Project: "group/upstream", Pipeline: true},
+	}
+
+	assert.ElementsMatch(t, expectedNeeds, needs)
+
+	expanded := crawler.expandNeeds(needs, &ciVariables{predefined: Variables{"CI_COMMIT_REF_NAME": "main"}})
+	assert.Contains(t, expanded, CrossProjectNeed{
+		SourceJob:  "package",
+		Project:    "$UPSTREAM_PROJECT",
+		Job:        "compile",
+		Ref:        "main",
+		Unresolved: true,
+	})
+}
@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"golang.org/x/sync/singleflight"
+)
+
+// projectCache remembers the projects looked up by path during a crawl. Projects
+// that do not exist or cannot be seen are remembered as well, a missing template
+// project is usually included by many others.
+type projectCache struct {
+	mu       sync.Mutex
+	projects map[string]projectLookup
+	group    singleflight.Group
+}
+
+type projectLookup struct {
+	project gitlab.Project
+	err     error
+}
+
+func newProjectCache() *projectCache {
+	return &projectCache{projects: make(map[string]projectLookup)}
+}
+
+// GitLab paths are case-insensitive, includes often differ in case from the project.
+func projectCacheKey(path string) string {
+	return strings.ToLower(path)
+}
+
+func (pc *projectCache) get(path string) (projectLookup, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	l, ok := pc.projects[projectCacheKey(path)]
+	return l, ok
+}
+
+func (pc *projectCache) set(path string, l projectLookup) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.projects[projectCacheKey(path)] = l
+}
+
+// add stores a project that was found by other means than its path.
+func (pc *projectCache) add(project gitlab.Project) {
+	pc.set(project.PathWithNamespace, projectLookup{project: project})
+}
+
+// getProject looks up a project by its path, concurrent lookups of the same
+// project share a single API call. Errors other than a missing or forbidden
+// project are not cached.
+func (c *Crawler) getProject(ctx context.Context, path string) (gitlab.Project, error) {
+	if l, ok := c.projectCache.get(path); ok {
+		return l.project, l.err
+	}
+
+	v, _, _ := c.projectCache.group.Do(projectCacheKey(path), func() (interface{}, error) {
+		if l, ok := c.projectCache.get(path); ok {
+			return l, nil
+		}
+
+		p, err := c.gitlabClient.GetProjectFromPath(ctx, path)
+		l := projectLookup{project: p, err: err}
+		if err == nil || isMissingProject(err) {
+			c.projectCache.set(path, l)
+		}
+		return l, nil
+	})
+
+	l := v.(projectLookup)
+	return l.project, l.err
+}
+
+func isMissingProject(err error) bool {
+	return errors.Is(err, gitlab.ErrProjectNotFound) || errors.Is(err, gitlab.ErrProjectForbidden)
+}
+
+// createProjectTarget writes the node of the project an edge points to. A path
+// that still contains variables names no real project, it gets an Unresolved
+// node instead so it does not mix with the projects of the instance.
+func (c *Crawler) createProjectTarget(ctx context.Context, path string) (storage.NodeType, error) {
+	if strings.Contains(path, "$") {
+		if err := c.storage.CreateUnresolvedNode(ctx, path); err != nil {
+			return "", fmt.Errorf("failed to write unresolved project to storage: %w", err)
+		}
+		return storage.NodeTypeUnresolved, nil
+	}
+
+	if err := c.storage.CreateProjectNode(ctx, path); err != nil {
+		return "", fmt.Errorf("failed to write project to storage: %w", err)
+	}
+	return storage.NodeTypeProject, nil
+}
+
+// handleMissingProject records a project that an include or trigger points to
+// but that cannot be looked up, so the rest of the pipeline is still crawled.
+// Other errors are returned as they are.
+func (c *Crawler) handleMissingProject(ctx context.Context, path string, err error) error {
+	if !isMissingProject(err) {
+		return err
+	}
+
+	if !c.inScope(path) {
+		c.logger.Debug().
+			Str("Project", path).
+			Msg("not looking up project outside of the crawled groups")
+
+		if err := c.storage.CreateProjectNode(ctx, path); err != nil {
+			return fmt.Errorf("failed to write project to storage: %w", err)
+		}
+		return nil
+	}
+
+	reason := storage.MissingReasonNotFound
+	if errors.Is(err, gitlab.ErrProjectForbidden) {
+		reason = storage.MissingReasonForbidden
+	}
+
+	c.logger.Warn().
+		Str("Project", path).
+		Str("Reason", reason).
+		Msg("included project cannot be looked up")
+
+	if err := c.storage.CreateMissingProjectNode(ctx, path, reason); err != nil {
+		return fmt.Errorf("failed to write missing project to storage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerGetProject(t *testing.T) {
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"/api/v4/projects/platform%2Fci": {http.StatusOK, `{"id":7,"path_with_namespace":"platform/ci"}`},
+		"/api/v4/projects/gone%2Fci":     {http.StatusNotFound, `{"message":"404 Project Not Found"}`},
+		"/api/v4/projects/secret%2Fci":   {http.StatusForbidden, `{"message":"403 Forbidden"}`},
+		"/api/v4/projects/flaky%2Fci":    {http.StatusBadGateway, `bad gateway`},
+	}
+
+	calls := make(map[string]int)
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			calls[r.URL.EscapedPath()]++
+			resp := responses[r.URL.EscapedPath()]
+			return &http.Response{
+				StatusCode: resp.status,
+				Status:     http.StatusText(resp.status),
+				Body:       io.NopCloser(strings.NewReader(resp.body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	for i := 0; i < 2; i++ {
+		p, err := crawler.getProject(context.TODO(), "platform/ci")
+		assert.NoError(t, err)
+		assert.Equal(t, 7, p.ID)
+
+		_, err = crawler.getProject(context.TODO(), "gone/ci")
+		assert.ErrorIs(t, err, gitlab.ErrProjectNotFound)
+
+		_, err = crawler.getProject(context.TODO(), "secret/ci")
+		assert.ErrorIs(t, err, gitlab.ErrProjectForbidden)
+
+		_, err = crawler.getProject(context.TODO(), "flaky/ci")
+		assert.Error(t, err)
+	}
+
+	_, err = crawler.getProject(context.TODO(), "Platform/CI")
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]int{
+		"/api/v4/projects/platform%2Fci": 1,
+		"/api/v4/projects/gone%2Fci":     1,
+		"/api/v4/projects/secret%2Fci":   1,
+		"/api/v4/projects/flaky%2Fci":    2,
+	}, calls)
+}
+
+func TestCrawlerHandleMissingProject(t *testing.T) {
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	assert.NoError(t, crawler.handleMissingProject(context.TODO(), "gone/ci", gitlab.ErrProjectNotFound))
+	assert.NoError(t, crawler.handleMissingProject(context.TODO(), "secret/ci", gitlab.ErrProjectForbidden))
+	assert.ErrorIs(t, crawler.handleMissingProject(context.TODO(), "flaky/ci", io.ErrUnexpectedEOF), io.ErrUnexpectedEOF)
+}
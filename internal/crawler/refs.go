@@ -0,0 +1,225 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+const (
+	RefSelectionDefault    = "default"
+	RefSelectionProtected  = "protected"
+	RefSelectionTags       = "tags"
+	RefSelectionRecentTags = "recent-tags"
+)
+
+// pipelineRef is a branch or tag of a project whose pipeline is crawled.
+type pipelineRef struct {
+	name string
+	tag  bool
+}
+
+func validateRefSelection(cfg *Config) error {
+	switch cfg.RefSelection {
+	case RefSelectionDefault, RefSelectionProtected:
+	case RefSelectionTags, RefSelectionRecentTags:
+		if _, err := regexp.Compile(cfg.RefTagPattern); err != nil {
+			return fmt.Errorf("invalid tag pattern %q: %w", cfg.RefTagPattern, err)
+		}
+	default:
+		return fmt.Errorf("unknown ref selection: %s", cfg.RefSelection)
+	}
+
+	if cfg.RefSelection == RefSelectionRecentTags && cfg.RefRecentTags < 1 {
+		return fmt.Errorf("ref selection %s needs at least one tag, got %d", cfg.RefSelection, cfg.RefRecentTags)
+	}
+
+	return nil
+}
+
+// selectRefs lists the refs of a project that are crawled according to RefSelection.
+func (c *Crawler) selectRefs(ctx context.Context, project gitlab.Project) ([]pipelineRef, error) {
+	switch c.config.RefSelection {
+	case RefSelectionProtected:
+		branches, err := c.gitlabClient.ListBranches(ctx, project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list branches: %w", err)
+		}
+
+		refs := make([]pipelineRef, 0)
+		for _, b := range branches {
+			if b.Protected {
+				refs = append(refs, pipelineRef{name: b.Name})
+			}
+		}
+		return refs, nil
+	case RefSelectionTags, RefSelectionRecentTags:
+		tags, err := c.gitlabClient.ListTags(ctx, project.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+
+		return filterTags(tags, c.tagPattern, c.config.RefSelection == RefSelectionRecentTags, c.config.RefRecentTags), nil
+	default:
+		return []pipelineRef{{name: project.DefaultBranch}}, nil
+	}
+}
+
+// filterTags keeps the tags matching pattern, if limited is set only the first
+// limit of them are kept. Tags are expected to be sorted newest first.
+func filterTags(tags []gitlab.Tag, pattern *regexp.Regexp, limited bool, limit int) []pipelineRef {
+	refs := make([]pipelineRef, 0)
+	for _, t := range tags {
+		if limited && len(refs) == limit {
+			break
+		}
+
+		if pattern != nil && !pattern.MatchString(t.Name) {
+			continue
+		}
+
+		refs = append(refs, pipelineRef{name: t.Name, tag: true})
+	}
+	return refs
+}
+
+// The kinds of refs an include or trigger can point to. Branches and HEAD
+// move with every push, tags and SHAs pin the consumer to a fixed version.
+const (
+	RefTypeBranch  = "branch"
+	RefTypeTag     = "tag"
+	RefTypeSHA     = "sha"
+	RefTypeHEAD    = "HEAD"
+	RefTypeMissing = "missing"
+)
+
+var shaPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// resolvedRef is the commit a ref pointed to at crawl time.
+type resolvedRef struct {
+	// name is the tag a component version like `~latest` resolved to.
+	name    string
+	sha     string
+	refType string
+}
+
+// refCache remembers the resolved refs of a crawl, the same template
+// project is usually included at the same handful of refs by everyone.
+type refCache struct {
+	mu   sync.Mutex
+	refs map[string]resolvedRef
+}
+
+func newRefCache() *refCache {
+	return &refCache{refs: make(map[string]resolvedRef)}
+}
+
+func (rc *refCache) get(key string) (resolvedRef, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	r, ok := rc.refs[key]
+	return r, ok
+}
+
+func (rc *refCache) set(key string, r resolvedRef) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.refs[key] = r
+}
+
+// resolveRef finds the commit a ref of a project points to and what kind of ref
+// it is. Branches win over tags of the same name, anything that is neither is
+// looked up as a commit SHA.
+func (c *Crawler) resolveRef(ctx context.Context, projectPath, ref string) (resolvedRef, error) {
+	key := projectPath + "@" + ref
+	if r, ok := c.refCache.get(key); ok {
+		return r, nil
+	}
+
+	r, err := c.lookupRef(ctx, projectPath, ref)
+	if err != nil {
+		return resolvedRef{}, err
+	}
+
+	c.refCache.set(key, r)
+	return r, nil
+}
+
+func (c *Crawler) lookupRef(ctx context.Context, projectPath, ref string) (resolvedRef, error) {
+	if ref == "HEAD" {
+		commit, err := c.gitlabClient.GetCommit(ctx, projectPath, ref)
+		if err != nil {
+			return missingRef(err)
+		}
+		return resolvedRef{sha: commit.ID, refType: RefTypeHEAD}, nil
+	}
+
+	branch, err := c.gitlabClient.GetBranch(ctx, projectPath, ref)
+	if err == nil {
+		return resolvedRef{sha: branch.Commit.ID, refType: RefTypeBranch}, nil
+	}
+	if !errors.Is(err, gitlab.ErrRefNotFound) {
+		return resolvedRef{}, err
+	}
+
+	tag, err := c.gitlabClient.GetTag(ctx, projectPath, ref)
+	if err == nil {
+		return resolvedRef{sha: tag.Commit.ID, refType: RefTypeTag}, nil
+	}
+	if !errors.Is(err, gitlab.ErrRefNotFound) {
+		return resolvedRef{}, err
+	}
+
+	if !shaPattern.MatchString(ref) {
+		return resolvedRef{refType: RefTypeMissing}, nil
+	}
+
+	commit, err := c.gitlabClient.GetCommit(ctx, projectPath, ref)
+	if err != nil {
+		return missingRef(err)
+	}
+
+	if !strings.HasPrefix(commit.ID, ref) {
+		return resolvedRef{refType: RefTypeMissing}, nil
+	}
+
+	return resolvedRef{sha: commit.ID, refType: RefTypeSHA}, nil
+}
+
+func missingRef(err error) (resolvedRef, error) {
+	if errors.Is(err, gitlab.ErrRefNotFound) {
+		return resolvedRef{refType: RefTypeMissing}, nil
+	}
+	return resolvedRef{}, err
+}
+
+// refProperties adds the commit SHA and the kind of the ref an edge points to
+// to its properties. Refs that still contain variables are not resolved.
+func (c *Crawler) refProperties(ctx context.Context, properties map[string]interface{}, projectPath, ref string, unresolved bool) map[string]interface{} {
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+
+	if unresolved || projectPath == "" || ref == "" {
+		return properties
+	}
+
+	r, err := c.resolveRef(ctx, projectPath, ref)
+	if err != nil {
+		c.logger.Warn().
+			Err(err).
+			Str("Project", projectPath).
+			Str("Ref", ref).
+			Msg("failed to resolve ref")
+		return properties
+	}
+
+	properties["sha"] = r.sha
+	properties["ref_type"] = r.refType
+	return properties
+}
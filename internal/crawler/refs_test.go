@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterTags(t *testing.T) {
+	tags := []gitlab.Tag{
+		{Name: "v2.1.0"},
+		{Name: "nightly"},
+		{Name: "v2.0.0"},
+		{Name: "v1.9.3"},
+	}
+	semver := regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+
+	testData := []struct {
+		Name     string
+		Pattern  *regexp.Regexp
+		Limited  bool
+		Limit    int
+		Expected []pipelineRef
+	}{
+		{
+			Name:    "AllTags",
+			Pattern: regexp.MustCompile(".*"),
+			Expected: []pipelineRef{
+				{name: "v2.1.0", tag: true},
+				{name: "nightly", tag: true},
+				{name: "v2.0.0", tag: true},
+				{name: "v1.9.3", tag: true},
+			},
+		},
+		{
+			Name:    "MatchingPattern",
+			Pattern: semver,
+			Expected: []pipelineRef{
+				{name: "v2.1.0", tag: true},
+				{name: "v2.0.0", tag: true},
+				{name: "v1.9.3", tag: true},
+			},
+		},
+		{
+			Name:    "MostRecentMatching",
+			Pattern: semver,
+			Limited: true,
+			Limit:   2,
+			Expected: []pipelineRef{
+				{name: "v2.1.0", tag: true},
+				{name: "v2.0.0", tag: true},
+			},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			assert.Equal(t, td.Expected, filterTags(tags, td.Pattern, td.Limited, td.Limit))
+		})
+	}
+}
+
+func TestValidateRefSelection(t *testing.T) {
+	assert.NoError(t, validateRefSelection(&Config{RefSelection: RefSelectionDefault}))
+	assert.NoError(t, validateRefSelection(&Config{RefSelection: RefSelectionRecentTags, RefTagPattern: "^v", RefRecentTags: 3}))
+	assert.Error(t, validateRefSelection(&Config{RefSelection: "all"}))
+	assert.Error(t, validateRefSelection(&Config{RefSelection: RefSelectionTags, RefTagPattern: "("}))
+	assert.Error(t, validateRefSelection(&Config{RefSelection: RefSelectionRecentTags, RefTagPattern: ".*"}))
+}
+
+func TestCrawlerResolveRef(t *testing.T) {
+	const sha = "8f3c1f0e2b9d4a6c7e5f1a2b3c4d5e6f7a8b9c0d"
+
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci/repository/branches/main":   `{"name":"main","commit":{"id":"` + sha + `"}}`,
+		"/api/v4/projects/platform%2Fci/repository/tags/v1.0.0":     `{"name":"v1.0.0","commit":{"id":"` + sha + `"}}`,
+		"/api/v4/projects/platform%2Fci/repository/commits/8f3c1f0": `{"id":"` + sha + `"}`,
+		"/api/v4/projects/platform%2Fci/repository/commits/HEAD":    `{"id":"` + sha + `"}`,
+	}
+
+	calls := 0
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			calls++
+			body, ok := responses[r.URL.EscapedPath()]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	testData := []struct {
+		Ref      string
+		Expected resolvedRef
+	}{
+		{Ref: "main", Expected: resolvedRef{sha: sha, refType: RefTypeBranch}},
+		{Ref: "v1.0.0", Expected: resolvedRef{sha: sha, refType: RefTypeTag}},
+		{Ref: "8f3c1f0", Expected: resolvedRef{sha: sha, refType: RefTypeSHA}},
+		{Ref: "HEAD", Expected: resolvedRef{sha: sha, refType: RefTypeHEAD}},
+		{Ref: "does-not-exist", Expected: resolvedRef{refType: RefTypeMissing}},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Ref, func(t *testing.T) {
+			r, err := crawler.resolveRef(context.TODO(), "platform/ci", td.Ref)
+			assert.NoError(t, err)
+			assert.Equal(t, td.Expected, r)
+		})
+	}
+
+	callsBefore := calls
+	_, err = crawler.resolveRef(context.TODO(), "platform/ci", "v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, callsBefore, calls, "resolved refs should be cached")
+}
+
+func TestFileRef(t *testing.T) {
+	project := gitlab.Project{DefaultBranch: "main"}
+
+	assert.Equal(t, "main", fileRef(RemoteInclude{}, project))
+	assert.Equal(t, "main", fileRef(RemoteInclude{Ref: "HEAD"}, project))
+	assert.Equal(t, "v1.4.0", fileRef(RemoteInclude{Ref: "v1.4.0"}, project))
+}
+
+func TestCrawlerHandleProjectIncludeReadsAtIncludeRef(t *testing.T) {
+	const sha = "1f0e2b9d4a6c7e5f1a2b3c4d5e6f7a8b9c0d8f3c"
+
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                                        `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/tags/v1.4.0":                 `{"name":"v1.4.0","commit":{"id":"` + sha + `"}}`,
+		"/api/v4/projects/2/repository/files/templates%2Fbuild.yml/raw@" + sha:  "include:\n  - local: /templates/nested.yml\n",
+		"/api/v4/projects/2/repository/files/templates%2Fnested.yml/raw@" + sha: "nested:\n  script: [echo]\n",
+	}
+
+	read := make([]string, 0)
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+				read = append(read, key)
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{DefaultRefName: "HEAD"}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "my-group/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	err = crawler.handleProjectInclude(context.TODO(), source, RemoteInclude{
+		Project: "platform/ci",
+		Ref:     "v1.4.0",
+		Files:   StringArray{"/templates/build.yml"},
+	}, make(map[string]struct{}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"/api/v4/projects/2/repository/files/templates%2Fbuild.yml/raw@" + sha,
+		"/api/v4/projects/2/repository/files/templates%2Fnested.yml/raw@" + sha,
+	}, read)
+}
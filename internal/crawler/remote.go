@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+var ErrRemoteHostNotAllowed = errors.New("remote include host is not in the allow list")
+var ErrRemoteFileTooLarge = errors.New("remote include exceeds the maximum size")
+
+// newRemoteClient sets up the client for remote includes. Redirects are
+// followed only to allowed hosts, otherwise an allowed host could send the
+// crawler anywhere.
+func newRemoteClient(cfg *Config) *http.Client {
+	retryClient := newRetryClient(cfg)
+
+	retryClient.HTTPClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.URL.Scheme != "https" && req.URL.Scheme != "http" {
+			return fmt.Errorf("unsupported remote include scheme: %s", req.URL.Scheme)
+		}
+		if !remoteHostAllowed(req.URL.Hostname(), cfg.RemoteIncludeAllowedHosts) {
+			return fmt.Errorf("redirect to %s: %w", req.URL.Hostname(), ErrRemoteHostNotAllowed)
+		}
+		return nil
+	}
+
+	retryClient.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if errors.Is(err, ErrRemoteHostNotAllowed) {
+			return false, nil
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+
+	return retryClient.StandardClient()
+}
+
+// getRemoteFile downloads a file referenced by `include:remote`.
+// Only hosts from RemoteIncludeAllowedHosts are contacted, and the
+// body is capped at RemoteIncludeMaxSize bytes to keep a misbehaving
+// server from blowing up the crawler's memory.
+func (c *Crawler) getRemoteFile(ctx context.Context, remoteURL string) ([]byte, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote include URL: %w", err)
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported remote include scheme: %s", u.Scheme)
+	}
+
+	if !remoteHostAllowed(u.Hostname(), c.config.RemoteIncludeAllowedHosts) {
+		return nil, fmt.Errorf("%s: %w", u.Hostname(), ErrRemoteHostNotAllowed)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, remoteURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request for remote include: %w", err)
+	}
+
+	resp, err := c.remoteClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote include: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to get remote include, got bad response: %s", resp.Status)
+	}
+
+	// Read one byte past the limit so we can tell a file that is exactly
+	// at the limit apart from one that is too large.
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.config.RemoteIncludeMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote include body: %w", err)
+	}
+
+	if int64(len(body)) > c.config.RemoteIncludeMaxSize {
+		return nil, ErrRemoteFileTooLarge
+	}
+
+	return body, nil
+}
+
+func remoteHostAllowed(host string, allowedHosts []string) bool {
+	for _, h := range allowedHosts {
+		if strings.EqualFold(host, strings.TrimSpace(h)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type doer struct {
+	doFunc func(r *http.Request) (*http.Response, error)
+}
+
+func (d *doer) Do(r *http.Request) (*http.Response, error) {
+	return d.doFunc(r)
+}
+
+func TestCrawlerGetRemoteFile(t *testing.T) {
+	okFunc := func(body string) func(r *http.Request) (*http.Response, error) {
+		return func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}
+	}
+
+	testData := []struct {
+		Name   string
+		URL    string
+		DoFunc func(r *http.Request) (*http.Response, error)
+		Out    []byte
+		Err    error
+	}{
+		{
+			Name:   "AllowedHost",
+			URL:    "https://templates.example.com/build.yml",
+			DoFunc: okFunc("test"),
+			Out:    []byte("test"),
+		},
+		{
+			Name:   "AllowedHostCaseInsensitive",
+			URL:    "https://Templates.Example.com/build.yml",
+			DoFunc: okFunc("test"),
+			Out:    []byte("test"),
+		},
+		{
+			Name:   "HostNotAllowed",
+			URL:    "https://evil.example.com/build.yml",
+			DoFunc: okFunc("test"),
+			Err:    ErrRemoteHostNotAllowed,
+		},
+		{
+			Name:   "FileTooLarge",
+			URL:    "https://templates.example.com/build.yml",
+			DoFunc: okFunc("this body is too large"),
+			Err:    ErrRemoteFileTooLarge,
+		},
+		{
+			Name: "NotFound",
+			URL:  "https://templates.example.com/build.yml",
+			DoFunc: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Status:     "404 Not Found",
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil
+			},
+			Err: errors.New("failed to get remote include, got bad response: 404 Not Found"),
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			crawler, err := New(&Config{
+				RemoteIncludeAllowedHosts: []string{"templates.example.com"},
+				RemoteIncludeMaxSize:      16,
+			}, zerolog.Logger{}, NilStorage{})
+			if err != nil {
+				t.Fatalf("failed to initialse crawler: %s", err)
+			}
+			crawler.remoteClient = &doer{doFunc: td.DoFunc}
+
+			out, err := crawler.getRemoteFile(context.TODO(), td.URL)
+			if td.Err != nil {
+				if !errors.Is(err, td.Err) {
+					assert.EqualError(t, err, td.Err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, td.Out, out)
+		})
+	}
+}
+
+func TestCrawlerGetRemoteFileRedirect(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.yml":
+			http.Redirect(w, r, "/build.yml", http.StatusFound)
+		case "/elsewhere.yml":
+			// Same server, but under a host name that is not allowed.
+			u, _ := url.Parse(server.URL)
+			http.Redirect(w, r, "http://localhost:"+u.Port()+"/build.yml", http.StatusFound)
+		case "/build.yml":
+			_, _ = w.Write([]byte("test"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	crawler, err := New(&Config{
+		RemoteIncludeAllowedHosts: []string{"127.0.0.1"},
+		RemoteIncludeMaxSize:      16,
+	}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	out, err := crawler.getRemoteFile(context.TODO(), server.URL+"/moved.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("test"), out)
+
+	out, err = crawler.getRemoteFile(context.TODO(), server.URL+"/elsewhere.yml")
+	assert.ErrorIs(t, err, ErrRemoteHostNotAllowed)
+	assert.Nil(t, out)
+}
@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// Spec is the `spec:` header of a CI file, see
+// https://docs.gitlab.com/ee/ci/yaml/#spec
+type Spec struct {
+	Inputs []SpecInput
+}
+
+// SpecInput is a single input declared in `spec:inputs`.
+// Inputs without a default value have to be passed by every consumer.
+type SpecInput struct {
+	Name        string
+	Type        string
+	Description string
+	Default     interface{}
+	HasDefault  bool
+	Options     []interface{}
+}
+
+// parseSpec reads the `spec:inputs` of a CI file, it returns nil if the file
+// has no `spec:` header.
+func (c *Crawler) parseSpec(parsed map[string]interface{}) *Spec {
+	rawSpec, exists := parsed["spec"]
+	if !exists {
+		return nil
+	}
+
+	spec := &Spec{Inputs: make([]SpecInput, 0)}
+
+	specMap, ok := rawSpec.(map[string]interface{})
+	if !ok {
+		return spec
+	}
+
+	rawInputs, ok := specMap["inputs"].(map[string]interface{})
+	if !ok {
+		return spec
+	}
+
+	for name, rawInput := range rawInputs {
+		input := SpecInput{Name: name, Type: "string"}
+
+		// An input without any configuration is a required string.
+		inputMap, ok := rawInput.(map[string]interface{})
+		if ok {
+			if t := extractFieldFromMap("type", inputMap); t != "" {
+				input.Type = t
+			}
+			input.Description = extractFieldFromMap("description", inputMap)
+			input.Default, input.HasDefault = inputMap["default"]
+			input.Options, _ = inputMap["options"].([]interface{})
+		}
+
+		spec.Inputs = append(spec.Inputs, input)
+	}
+
+	sort.Slice(spec.Inputs, func(i, j int) bool {
+		return spec.Inputs[i].Name < spec.Inputs[j].Name
+	})
+
+	return spec
+}
+
+// validateInputs compares the inputs passed by a consumer against the spec of the
+// included file and returns the inputs the spec does not know about and the
+// required inputs that were not passed. A nil spec accepts no inputs at all.
+func validateInputs(spec *Spec, inputs map[string]interface{}) (unknown []string, missing []string) {
+	unknown, missing = make([]string, 0), make([]string, 0)
+
+	declared := make(map[string]struct{})
+	if spec != nil {
+		for _, input := range spec.Inputs {
+			declared[input.Name] = struct{}{}
+			if _, passed := inputs[input.Name]; !passed && !input.HasDefault {
+				missing = append(missing, input.Name)
+			}
+		}
+	}
+
+	for name := range inputs {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+	sort.Strings(missing)
+
+	return unknown, missing
+}
+
+// handleSpec stores the inputs declared by files inside of projects and checks
+// the inputs the including file passed against them.
+// Mismatches are stored as an edge from the including file to this file.
+func (c *Crawler) handleSpec(ctx context.Context, source ciFileSource, spec *Spec) error {
+	if source.nodeType == storage.NodeTypeProject && source.file != "" {
+		file := storage.File{
+			Project: source.name,
+			Path:    source.file,
+			Ref:     source.ref,
+		}
+
+		if spec != nil {
+			for _, input := range spec.Inputs {
+				file.Inputs = append(file.Inputs, storage.Input{
+					Name:        input.Name,
+					Type:        input.Type,
+					Description: input.Description,
+					Default:     input.Default,
+					Options:     input.Options,
+					Required:    !input.HasDefault,
+				})
+			}
+		}
+
+		if err := c.storage.CreateFileNode(ctx, file); err != nil {
+			return fmt.Errorf("failed to write file to storage: %w", err)
+		}
+	}
+
+	if source.includedBy == nil {
+		return nil
+	}
+
+	unknown, missing := validateInputs(spec, source.inputs)
+	if len(unknown) == 0 && len(missing) == 0 {
+		return nil
+	}
+
+	c.logger.Warn().
+		Str("Consumer", source.includedBy.name).
+		Str("Source", source.name).
+		Str("File", source.file).
+		Strs("UnknownInputs", unknown).
+		Strs("MissingInputs", missing).
+		Msg("include passes inputs that do not match the spec")
+
+	targetType, targetID := source.fileNode()
+	return c.storage.CreateInputMismatchEdge(ctx, storage.Edge{
+		SourceType:    source.includedBy.nodeType,
+		SourceProject: source.includedBy.name,
+		SourceRef:     source.includedBy.ref,
+		Pipeline:      source.pipeline(),
+		TargetType:    targetType,
+		TargetProject: targetID,
+		Properties: map[string]interface{}{
+			"file":           source.file,
+			"unknown_inputs": unknown,
+			"missing_inputs": missing,
+		},
+	})
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlerParseSpec(t *testing.T) {
+	testFile, err := os.ReadFile("../../test-files/gitlab-ci-spec.yaml")
+	if err != nil {
+		t.Fatal("cannot find test file")
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	parsed, err := crawler.UnmarshalCIFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to parse spec: %s", err)
+	}
+	spec := crawler.parseSpec(parsed)
+
+	assert.Equal(t, &Spec{Inputs: []SpecInput{
+		{Name: "environment", Type: "string", Default: "staging", HasDefault: true, Options: []interface{}{"staging", "production"}},
+		{Name: "image", Type: "string", Description: "the image to build"},
+		{Name: "retries", Type: "number", Default: 2, HasDefault: true},
+		{Name: "stage", Type: "string", Description: "the stage the job runs in", Default: "test", HasDefault: true},
+	}}, spec)
+
+	// the jobs after the header still have to be found
+	includes, err := crawler.parseIncludes(parsed)
+	if err != nil {
+		t.Fatalf("failed to parse includes: %s", err)
+	}
+	assert.Equal(t, []RemoteInclude{{Local: "ci/lint.yml"}}, includes)
+
+	triggers := crawler.parseTriggers(parsed)
+	assert.Equal(t, []RawTrigger{{Job: "build", Project: "project/deploy"}}, triggers)
+}
+
+func TestValidateInputs(t *testing.T) {
+	spec := &Spec{Inputs: []SpecInput{
+		{Name: "image"},
+		{Name: "stage", Default: "test", HasDefault: true},
+	}}
+
+	testData := []struct {
+		Name    string
+		Spec    *Spec
+		Inputs  map[string]interface{}
+		Unknown []string
+		Missing []string
+	}{
+		{
+			Name:    "Valid",
+			Spec:    spec,
+			Inputs:  map[string]interface{}{"image": "alpine"},
+			Unknown: []string{},
+			Missing: []string{},
+		},
+		{
+			Name:    "UnknownAndMissing",
+			Spec:    spec,
+			Inputs:  map[string]interface{}{"stages": "build"},
+			Unknown: []string{"stages"},
+			Missing: []string{"image"},
+		},
+		{
+			Name:    "NoSpec",
+			Spec:    nil,
+			Inputs:  map[string]interface{}{"image": "alpine"},
+			Unknown: []string{"image"},
+			Missing: []string{},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			unknown, missing := validateInputs(td.Spec, td.Inputs)
+			assert.Equal(t, td.Unknown, unknown)
+			assert.Equal(t, td.Missing, missing)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+// activityGranularity is how long GitLab waits before it updates the
+// last_activity_at of a project again, projects are asked for from this
+// long before the last crawl so no activity is missed.
+const activityGranularity = time.Hour
+
+// crawlState is what an incremental crawl remembers about the previous one,
+// it is stored as JSON in the StateFile.
+type crawlState struct {
+	mu sync.Mutex
+
+	// LastCrawl is the time the last successful crawl started at.
+	LastCrawl time.Time            `json:"last_crawl"`
+	Projects  map[int]projectState `json:"projects"`
+
+	// localIncludes holds the projects whose pipeline included local
+	// files during this crawl.
+	localIncludes map[int]struct{}
+	// handled holds the projects a worker was done with during this crawl.
+	handled map[int]struct{}
+}
+
+// projectState is the state of a single project at the time it was crawled.
+// LocalIncludes is set if the pipeline includes other files of the project,
+// then an unchanged CI file does not mean the pipeline is unchanged. Failed is
+// set if not all refs of the project were written, those projects are crawled
+// again by the next crawl whether they were active or not. Refs are the refs
+// whose pipelines wrote edges, they are removed even if a ref is gone by then.
+type projectState struct {
+	Path           string    `json:"path"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	CIFileBlobID   string    `json:"ci_file_blob_id"`
+	LocalIncludes  bool      `json:"local_includes"`
+	Failed         bool      `json:"failed,omitempty"`
+	Refs           []string  `json:"refs,omitempty"`
+}
+
+// loadCrawlState reads the state of the previous crawl, without a state
+// file the returned state is empty and everything is crawled.
+func loadCrawlState(path string) (*crawlState, error) {
+	state := &crawlState{
+		Projects:      make(map[int]projectState),
+		localIncludes: make(map[int]struct{}),
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read crawl state: %w", err)
+	}
+
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to parse crawl state %s: %w", path, err)
+	}
+
+	if state.Projects == nil {
+		state.Projects = make(map[int]projectState)
+	}
+
+	return state, nil
+}
+
+// save writes the state next to path first and moves it in place after,
+// a crawl that is killed while saving keeps the previous state.
+func (s *crawlState) save(path string) error {
+	s.mu.Lock()
+	b, err := json.Marshal(s)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal crawl state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// activityAfter is the time projects need to have been active after to be crawled again.
+func (s *crawlState) activityAfter() time.Time {
+	if s.LastCrawl.IsZero() {
+		return time.Time{}
+	}
+	return s.LastCrawl.Add(-activityGranularity)
+}
+
+func (s *crawlState) project(id int) (projectState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.Projects[id]
+	return p, ok
+}
+
+// crawled records a project once all of its refs were written to the storage.
+func (s *crawlState) crawled(project gitlab.Project, blobID string, refs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, localIncludes := s.localIncludes[project.ID]
+	delete(s.localIncludes, project.ID)
+	s.handle(project.ID)
+
+	s.Projects[project.ID] = projectState{
+		Path:           project.PathWithNamespace,
+		LastActivityAt: project.LastActivityAt,
+		CIFileBlobID:   blobID,
+		LocalIncludes:  localIncludes,
+		Refs:           refs,
+	}
+}
+
+// failed records a project whose crawl did not finish. Its previous activity
+// is kept, a failed project is never skipped as unchanged. The refs that were
+// crawled are added to the previous ones, they may have written some edges.
+func (s *crawlState) failed(project gitlab.Project, refs []string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.localIncludes, project.ID)
+	s.handle(project.ID)
+
+	p := s.Projects[project.ID]
+	p.Path = project.PathWithNamespace
+	p.Failed = true
+	p.Refs = mergeRefs(p.Refs, refs)
+	s.Projects[project.ID] = p
+}
+
+// mergeRefs returns the refs of both lists, each of them once.
+func mergeRefs(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]struct{}, len(a)+len(b))
+	for _, ref := range append(append([]string(nil), a...), b...) {
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		merged = append(merged, ref)
+	}
+	return merged
+}
+
+// failedProjects returns the paths of the projects whose last crawl failed by their ID.
+func (s *crawlState) failedProjects() map[int]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := make(map[int]string)
+	for id, p := range s.Projects {
+		if p.Failed {
+			failed[id] = p.Path
+		}
+	}
+	return failed
+}
+
+// retryFailedProjects hands the projects that failed in the previous crawl to
+// the workers again. Without activity they are not part of the project stream,
+// those that were streamed and handled in this crawl already are left out.
+func (c *Crawler) retryFailedProjects(ctx context.Context, failed map[int]string, projects chan<- gitlab.Project) {
+	ids := make([]int, 0, len(failed))
+	for id := range failed {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		path := failed[id]
+		if !c.inScope(path) {
+			continue
+		}
+
+		if c.state.wasHandled(id) {
+			continue
+		}
+
+		p, err := c.getProject(ctx, path)
+		if err != nil {
+			c.logger.Warn().
+				Err(err).
+				Str("Project", path).
+				Msg("failed to look up project that failed in the previous crawl")
+			continue
+		}
+
+		c.logger.Info().
+			Str("Project", p.PathWithNamespace).
+			Msg("crawling project again that failed in the previous crawl")
+
+		select {
+		case projects <- p:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// touched moves the activity of a project that was not crawled again
+// since nothing in its pipeline changed.
+func (s *crawlState) touched(project gitlab.Project) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handle(project.ID)
+
+	p := s.Projects[project.ID]
+	p.LastActivityAt = project.LastActivityAt
+	s.Projects[project.ID] = p
+}
+
+// handle marks a project as done for this crawl, s.mu has to be held.
+func (s *crawlState) handle(projectID int) {
+	if s.handled == nil {
+		s.handled = make(map[int]struct{})
+	}
+	s.handled[projectID] = struct{}{}
+}
+
+// wasHandled tells if a worker was done with a project during this crawl.
+func (s *crawlState) wasHandled(projectID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.handled[projectID]
+	return ok
+}
+
+func (s *crawlState) markLocalInclude(projectID int) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.localIncludes[projectID] = struct{}{}
+}
+
+// projectChanged decides if a project has to be crawled again. Projects are
+// skipped if there was no activity since they were last crawled, or if the
+// activity did not change their CI file and the pipeline reads no other file of
+// the project. The blob ID of the CI file is returned to be stored once the
+// project was crawled.
+func (c *Crawler) projectChanged(ctx context.Context, project gitlab.Project) (bool, string, error) {
+	previous, known := c.state.project(project.ID)
+	if known && !previous.Failed && !project.LastActivityAt.After(previous.LastActivityAt) {
+		return false, previous.CIFileBlobID, nil
+	}
+
+	ciConfig := parseCIConfigPath(project.CIConfigPath)
+	if ciConfig.Local == "" || project.DefaultBranch == "" {
+		return true, "", nil
+	}
+
+	blobID, err := c.gitlabClient.GetFileBlobID(ctx, project.ID, ciConfig.Local, project.DefaultBranch)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get blob of %s: %w", ciConfig.Local, err)
+	}
+
+	// Other refs than the default branch come and go without any
+	// change to the CI file on the default branch.
+	if !known || previous.Failed || previous.LocalIncludes || c.config.RefSelection != RefSelectionDefault {
+		return true, blobID, nil
+	}
+
+	return blobID != previous.CIFileBlobID, blobID, nil
+}
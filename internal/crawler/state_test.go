@@ -0,0 +1,274 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrawlStateSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := loadCrawlState(path)
+	assert.NoError(t, err)
+	assert.True(t, state.activityAfter().IsZero(), "a missing state file crawls everything")
+
+	lastCrawl := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	activity := time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC)
+
+	state.LastCrawl = lastCrawl
+	state.markLocalInclude(1)
+	state.crawled(gitlab.Project{ID: 1, PathWithNamespace: "team/app", LastActivityAt: activity}, "blob", []string{"main"})
+	assert.NoError(t, state.save(path))
+
+	loaded, err := loadCrawlState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, lastCrawl.Add(-time.Hour), loaded.activityAfter())
+	assert.Equal(t, map[int]projectState{
+		1: {Path: "team/app", LastActivityAt: activity, CIFileBlobID: "blob", LocalIncludes: true, Refs: []string{"main"}},
+	}, loaded.Projects)
+}
+
+func TestCrawlerProjectChanged(t *testing.T) {
+	lastCrawl := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := lastCrawl.Add(2 * time.Hour)
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("X-Gitlab-Blob-Id", "blob-"+r.URL.Query().Get("ref"))
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{RefSelection: RefSelectionDefault}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+	crawler.state = &crawlState{
+		Projects: map[int]projectState{
+			1: {LastActivityAt: lastCrawl, CIFileBlobID: "blob-main"},
+			2: {LastActivityAt: lastCrawl, CIFileBlobID: "blob-old"},
+			3: {LastActivityAt: lastCrawl, CIFileBlobID: "blob-main", LocalIncludes: true},
+			5: {LastActivityAt: lastCrawl, CIFileBlobID: "blob-main", Failed: true},
+		},
+	}
+
+	testData := []struct {
+		Name     string
+		Project  gitlab.Project
+		Expected bool
+	}{
+		{
+			Name:     "NoActivity",
+			Project:  gitlab.Project{ID: 1, DefaultBranch: "main", LastActivityAt: lastCrawl},
+			Expected: false,
+		},
+		{
+			Name:     "SameCIFile",
+			Project:  gitlab.Project{ID: 1, DefaultBranch: "main", LastActivityAt: later},
+			Expected: false,
+		},
+		{
+			Name:     "ChangedCIFile",
+			Project:  gitlab.Project{ID: 2, DefaultBranch: "main", LastActivityAt: later},
+			Expected: true,
+		},
+		{
+			Name:     "SameCIFileWithLocalIncludes",
+			Project:  gitlab.Project{ID: 3, DefaultBranch: "main", LastActivityAt: later},
+			Expected: true,
+		},
+		{
+			Name:     "FailedWithoutActivity",
+			Project:  gitlab.Project{ID: 5, DefaultBranch: "main", LastActivityAt: lastCrawl},
+			Expected: true,
+		},
+		{
+			Name:     "NewProject",
+			Project:  gitlab.Project{ID: 4, DefaultBranch: "main", LastActivityAt: later},
+			Expected: true,
+		},
+		{
+			Name:     "CIConfigInOtherProject",
+			Project:  gitlab.Project{ID: 1, DefaultBranch: "main", LastActivityAt: later, CIConfigPath: ".gitlab-ci.yml@platform/ci"},
+			Expected: true,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			changed, _, err := crawler.projectChanged(context.TODO(), td.Project)
+			assert.NoError(t, err)
+			assert.Equal(t, td.Expected, changed)
+		})
+	}
+}
+
+func TestCrawlerRetryFailedProjects(t *testing.T) {
+	activity := time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC)
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			if r.URL.EscapedPath() != "/api/v4/projects/team%2Fapp" {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Project Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"id":1,"path_with_namespace":"team/app"}`)),
+			}, nil
+		},
+	}
+
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+	crawler.state = &crawlState{
+		Projects: map[int]projectState{
+			1: {Path: "team/app", LastActivityAt: activity, CIFileBlobID: "blob"},
+		},
+	}
+
+	// A failed crawl keeps the previous activity so the project is not skipped.
+	crawler.state.failed(gitlab.Project{ID: 1, PathWithNamespace: "team/app", LastActivityAt: activity.Add(time.Hour)}, []string{"main"})
+	crawler.state.failed(gitlab.Project{ID: 2, PathWithNamespace: "team/api"}, nil)
+	crawler.state.failed(gitlab.Project{ID: 3, PathWithNamespace: "team/gone"}, nil)
+	assert.Equal(t, projectState{Path: "team/app", LastActivityAt: activity, CIFileBlobID: "blob", Failed: true, Refs: []string{"main"}}, crawler.state.Projects[1])
+
+	failed := crawler.state.failedProjects()
+	assert.Equal(t, map[int]string{1: "team/app", 2: "team/api", 3: "team/gone"}, failed)
+
+	// The next crawl streamed and handled team/api already.
+	crawler.state = &crawlState{Projects: crawler.state.Projects}
+	crawler.state.crawled(gitlab.Project{ID: 2, PathWithNamespace: "team/api"}, "", nil)
+
+	projects := make(chan gitlab.Project, 10)
+	crawler.retryFailedProjects(context.TODO(), failed, projects)
+	close(projects)
+
+	retried := make([]string, 0)
+	for p := range projects {
+		retried = append(retried, p.PathWithNamespace)
+	}
+	assert.Equal(t, []string{"team/app"}, retried)
+	assert.False(t, crawler.state.Projects[2].Failed)
+}
+
+// includeEdgeStorage keeps the include edges written by the crawler.
+type includeEdgeStorage struct {
+	NilStorage
+	mu    sync.Mutex
+	edges []storage.Edge
+}
+
+func (s *includeEdgeStorage) CreateIncludeEdge(ctx context.Context, edge storage.Edge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.edges = append(s.edges, edge)
+	return nil
+}
+
+func TestCrawlerTagsEdgesWithTheirPipeline(t *testing.T) {
+	responses := map[string]string{
+		"/api/v4/projects/platform%2Fci":                          `{"id":2,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+		"/api/v4/projects/platform%2Fci/repository/branches/main": `{"name":"main","commit":{"id":"abc"}}`,
+		"/api/v4/projects/2/repository/files/build.yml/raw@abc":   "include:\n  - local: /lint.yml\n",
+		"/api/v4/projects/2/repository/files/lint.yml/raw@abc":    "lint:\n  script: [echo]\n",
+	}
+
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			key := r.URL.EscapedPath()
+			if ref := r.URL.Query().Get("ref"); ref != "" {
+				key += "@" + ref
+			}
+
+			body, ok := responses[key]
+			if !ok {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		},
+	}
+
+	store := &includeEdgeStorage{}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.gitlabClient = gitlab.NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	source.jobs = &jobIndex{}
+
+	err = crawler.handleProjectInclude(context.TODO(), source, RemoteInclude{
+		Project: "platform/ci",
+		Ref:     "main",
+		Files:   StringArray{"/build.yml"},
+	}, make(map[string]struct{}))
+	assert.NoError(t, err)
+
+	// The include inside of the template starts at the template but was found
+	// by the consumer, re-crawling the template must not remove it.
+	assert.Len(t, store.edges, 2)
+	for _, e := range store.edges {
+		assert.Equal(t, storage.PipelineID("team/app", "main"), e.Pipeline)
+	}
+	assert.Equal(t, "platform/ci", store.edges[1].SourceProject)
+}
+
+// removedEdgesStorage keeps the refs whose edges the crawler removed.
+type removedEdgesStorage struct {
+	NilStorage
+	removed map[string][]string
+}
+
+func (s *removedEdgesStorage) RemoveProjectEdges(ctx context.Context, project string, refs []string) error {
+	s.removed[project] = refs
+	return nil
+}
+
+func TestCrawlerRemoveProjectEdgesOfPreviousRefs(t *testing.T) {
+	store := &removedEdgesStorage{removed: make(map[string][]string)}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+	crawler.state = &crawlState{
+		Projects: map[int]projectState{
+			1: {Path: "team/app", Refs: []string{"main", "release-1"}},
+		},
+	}
+
+	// release-1 was deleted since the last crawl, its edges go as well.
+	assert.NoError(t, crawler.removeProjectEdges(context.TODO(), gitlab.Project{ID: 1, PathWithNamespace: "team/app"}, []string{"main", "release-2"}))
+	assert.NoError(t, crawler.removeProjectEdges(context.TODO(), gitlab.Project{ID: 2, PathWithNamespace: "team/new"}, []string{"main"}))
+
+	assert.Equal(t, map[string][]string{"team/app": {"main", "release-1", "release-2"}}, store.removed)
+}
@@ -1,8 +1,10 @@
 package crawler
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -10,12 +12,42 @@ import (
 )
 
 type RemoteInclude struct {
-	Project  string      `yaml:"project"`
-	Ref      string      `yaml:"ref"`
-	Files    StringArray `yaml:"file"`
-	Local    string      `yaml:"local"`
-	Remote   string      `yaml:"remote"`
-	Template string      `yaml:"template"`
+	Project   string      `yaml:"project"`
+	Ref       string      `yaml:"ref"`
+	Files     StringArray `yaml:"file"`
+	Local     string      `yaml:"local"`
+	Remote    string      `yaml:"remote"`
+	Template  string      `yaml:"template"`
+	Component string      `yaml:"component"`
+	// Artifact and Job are only used by child pipelines whose
+	// configuration is generated by a job of the parent pipeline.
+	Artifact string `yaml:"artifact"`
+	Job      string `yaml:"job"`
+	// Rules and Inputs are kept as found in the CI file, they are
+	// stored on the include edge as they are.
+	Rules  []interface{}          `yaml:"rules"`
+	Inputs map[string]interface{} `yaml:"inputs"`
+	// Unresolved is set when variables in the include could not be expanded.
+	Unresolved bool `yaml:"-"`
+}
+
+// edgeProperties turns the rules and inputs of an include into the properties
+// of its edge. Every input gets its own `inputs.<name>` property so consumers
+// can be queried by the values they pass.
+func (ri RemoteInclude) edgeProperties() map[string]interface{} {
+	properties := map[string]interface{}{
+		"conditional": len(ri.Rules) > 0,
+	}
+
+	if len(ri.Rules) > 0 {
+		properties["rules"] = ri.Rules
+	}
+
+	for name, value := range ri.Inputs {
+		properties["inputs."+name] = value
+	}
+
+	return properties
 }
 
 type StringArray []string
@@ -36,23 +68,117 @@ func (a *StringArray) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
-func (c *Crawler) UnmarshalCIFile(file []byte) (map[string]interface{}, error) {
-	var parsed map[string]interface{}
+// parseCIConfigPath turns the `ci_config_path` of a project into the include it
+// is equivalent to, see https://docs.gitlab.com/ee/ci/pipelines/settings.html#specify-a-custom-cicd-configuration-file
+// The path can be a file in the project, `<file>@<project>[:<ref>]` for a
+// file in another project, or a URL. An empty path means `.gitlab-ci.yml`.
+func parseCIConfigPath(ciConfigPath string) RemoteInclude {
+	switch {
+	case ciConfigPath == "":
+		return RemoteInclude{Local: gitlabCIFileName}
+	case strings.HasPrefix(ciConfigPath, "https://") || strings.HasPrefix(ciConfigPath, "http://"):
+		return RemoteInclude{Remote: ciConfigPath}
+	}
 
-	err := yaml.Unmarshal(file, &parsed)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal ci file: %s", err)
+	file, project, found := strings.Cut(ciConfigPath, "@")
+	if !found {
+		return RemoteInclude{Local: ciConfigPath}
 	}
 
-	return parsed, nil
+	project, ref, _ := strings.Cut(project, ":")
+
+	return RemoteInclude{
+		Project: project,
+		Files:   StringArray{file},
+		Ref:     ref,
+	}
 }
 
-func (c *Crawler) parseIncludes(file []byte) ([]RemoteInclude, error) {
-	parsed, err := c.UnmarshalCIFile(file)
+var ErrInvalidYAML = errors.New("failed to unmarshal ci file")
+
+// UnmarshalCIFile decodes every YAML document of a CI file into a single map.
+// Files with a `spec:` header consist of two documents, the header and the
+// jobs, so all keys of all documents are merged.
+func (c *Crawler) UnmarshalCIFile(file []byte) (map[string]interface{}, error) {
+	documents, err := decodeCIFile(file)
 	if err != nil {
 		return nil, err
 	}
+	return mergeDocuments(documents)
+}
+
+// decodeCIFile parses every YAML document of a CI file into a node. The nodes
+// keep tags like `!reference` that are lost when decoding into plain maps.
+func decodeCIFile(file []byte) ([]*yaml.Node, error) {
+	documents := make([]*yaml.Node, 0, 1)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(file))
+	for {
+		var document yaml.Node
+		err := decoder.Decode(&document)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%w: %s", ErrInvalidYAML, err)
+		}
+		documents = append(documents, &document)
+	}
+
+	return documents, nil
+}
+
+// mergeDocuments merges the top-level keys of all documents into a single map.
+func mergeDocuments(documents []*yaml.Node) (map[string]interface{}, error) {
+	parsed := make(map[string]interface{})
+
+	for _, document := range documents {
+		var keys map[string]interface{}
+		if err := document.Decode(&keys); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidYAML, err)
+		}
+
+		for k, v := range keys {
+			parsed[k] = v
+		}
+	}
 
+	return parsed, nil
+}
+
+// parseVariables reads the top-level `variables:` block of a CI file, variables
+// can either be plain values or maps with a `value` key.
+func (c *Crawler) parseVariables(parsed map[string]interface{}) Variables {
+	rawVariables, ok := parsed["variables"].(map[string]interface{})
+	if !ok {
+		return Variables{}
+	}
+
+	vars := make(Variables, len(rawVariables))
+	for k, v := range rawVariables {
+		switch val := v.(type) {
+		case nil:
+			vars[k] = ""
+		case string, int, float64, bool:
+			vars[k] = fmt.Sprint(val)
+		case map[string]interface{}:
+			value, exists := val["value"]
+			if !exists || value == nil {
+				vars[k] = ""
+				continue
+			}
+			vars[k] = fmt.Sprint(value)
+		default:
+			c.logger.Debug().
+				Str("Variable", k).
+				Msgf("skipping variable of type %T", val)
+		}
+	}
+
+	return vars
+}
+
+func (c *Crawler) parseIncludes(parsed map[string]interface{}) ([]RemoteInclude, error) {
 	rawIncludes, exist := parsed["include"]
 	if !exist {
 		return []RemoteInclude{}, nil
@@ -79,6 +205,11 @@ func (c *Crawler) parseIncludes(file []byte) ([]RemoteInclude, error) {
 	for _, include := range includes {
 		switch i := include.(type) {
 		case string:
+			// The short form is a remote include if it is a URL.
+			if strings.HasPrefix(i, "https://") || strings.HasPrefix(i, "http://") {
+				rIncludes = append(rIncludes, RemoteInclude{Remote: i})
+				continue
+			}
 			rIncludes = append(rIncludes, RemoteInclude{Local: i})
 		case map[string]interface{}:
 			ri, err := c.parseIncludeMap(i)
@@ -95,15 +226,28 @@ func (c *Crawler) parseIncludes(file []byte) ([]RemoteInclude, error) {
 
 // parseIncludeMap takes a map or a string taken from the includes out of a gitlab-ci.yml
 // file and tries to parse them into the RemoteInclude struct.
-// Early exits are if `local`, `remote` or `template` are called.
+// Early exits are if `local`, `remote`, `template` or `component` are called.
+// The `rules` and `inputs` of the include are kept as they are for every kind of include.
 func (c *Crawler) parseIncludeMap(input map[string]interface{}) (RemoteInclude, error) {
 	const (
-		localIncludeKey    = "local"
-		remoteIncludeKey   = "remote"
-		templateIncludeKey = "template"
+		localIncludeKey     = "local"
+		remoteIncludeKey    = "remote"
+		templateIncludeKey  = "template"
+		componentIncludeKey = "component"
+		artifactIncludeKey  = "artifact"
 	)
 
-	for _, s := range []string{localIncludeKey, remoteIncludeKey, templateIncludeKey} {
+	include := RemoteInclude{}
+
+	if rules, ok := input["rules"].([]interface{}); ok {
+		include.Rules = rules
+	}
+
+	if inputs, ok := input["inputs"].(map[string]interface{}); ok {
+		include.Inputs = inputs
+	}
+
+	for _, s := range []string{localIncludeKey, remoteIncludeKey, templateIncludeKey, componentIncludeKey, artifactIncludeKey} {
 		val, ok := input[s]
 		if !ok {
 			continue
@@ -119,12 +263,18 @@ func (c *Crawler) parseIncludeMap(input map[string]interface{}) (RemoteInclude,
 
 		switch s {
 		case localIncludeKey:
-			return RemoteInclude{Local: sVal}, nil
+			include.Local = sVal
 		case remoteIncludeKey:
-			return RemoteInclude{Remote: sVal}, nil
+			include.Remote = sVal
 		case templateIncludeKey:
-			return RemoteInclude{Template: sVal}, nil
+			include.Template = sVal
+		case componentIncludeKey:
+			include.Component = sVal
+		case artifactIncludeKey:
+			include.Artifact = sVal
+			include.Job = extractFieldFromMap("job", input)
 		}
+		return include, nil
 	}
 
 	project, exists := input["project"]
@@ -171,11 +321,11 @@ func (c *Crawler) parseIncludeMap(input map[string]interface{}) (RemoteInclude,
 			Msg("failed to parse `Value` into string, skipping ref for `Project`")
 	}
 
-	return RemoteInclude{
-		Project: sProject,
-		Files:   sFiles,
-		Ref:     sRef,
-	}, nil
+	include.Project = sProject
+	include.Files = sFiles
+	include.Ref = sRef
+
+	return include, nil
 }
 
 func (c *Crawler) enrichIncludes(rawIncludes []RemoteInclude, defaultBranch, projectPathWithNamespace, defaultRefName string) []RemoteInclude {
@@ -197,14 +347,20 @@ func (c *Crawler) enrichIncludes(rawIncludes []RemoteInclude, defaultBranch, pro
 			}
 		case include.Local != "":
 			include.Project = projectPathWithNamespace
-			include.Ref = defaultBranch 
+			include.Ref = defaultBranch
 			include.Files = []string{include.Local}
 		case include.Remote != "":
-			// TODO: implement
+			// remote includes are identified by their URL alone and
+			// are followed in handleRemoteInclude
 		case include.Template != "":
-			include.Project = projectPathWithNamespace
-			include.Ref = defaultBranch
-			include.Files = []string{include.Template}
+			// templates are part of the GitLab instance and not of
+			// any project, they are followed in handleTemplateInclude
+		case include.Component != "":
+			// components carry their own project and version, they
+			// are resolved in handleComponentInclude
+		case include.Artifact != "":
+			// artifacts only exist once the parent pipeline ran, they
+			// are recorded as dynamic pipelines in handleChildPipeline
 		default:
 			c.logger.Warn().
 				Dict("include", zerolog.Dict().
@@ -220,18 +376,35 @@ func (c *Crawler) enrichIncludes(rawIncludes []RemoteInclude, defaultBranch, pro
 	return enrichedIncludes
 }
 
+// RawTrigger is the `trigger:` of a job. Multi-project pipelines set Project,
+// child pipelines set Includes with the configuration of the child pipeline.
+// See https://docs.gitlab.com/ee/ci/yaml/#trigger
 type RawTrigger struct {
-	Include string `yaml:"include"`
-	Project string `yaml:"project"`
-	Branch  string `yaml:"branch"`
+	Job      string                 `yaml:"-"`
+	Includes []RemoteInclude        `yaml:"include"`
+	Project  string                 `yaml:"project"`
+	Branch   string                 `yaml:"branch"`
+	Strategy string                 `yaml:"strategy"`
+	Forward  map[string]interface{} `yaml:"forward"`
+	// Unresolved is set when variables in the trigger could not be expanded.
+	Unresolved bool `yaml:"-"`
 }
 
-func (c *Crawler) parseTriggers(file []byte) ([]RawTrigger, error) {
-	parsed, err := c.UnmarshalCIFile(file)
-	if err != nil {
-		return nil, err
+// edgeProperties turns the options of a trigger into the properties of its edge.
+func (t RawTrigger) edgeProperties() map[string]interface{} {
+	properties := map[string]interface{}{
+		"job":      t.Job,
+		"strategy": t.Strategy,
 	}
 
+	for option, value := range t.Forward {
+		properties["forward."+option] = value
+	}
+
+	return properties
+}
+
+func (c *Crawler) parseTriggers(parsed map[string]interface{}) []RawTrigger {
 	triggers := make([]RawTrigger, 0)
 	for rawJob := range parsed {
 		job, isMap := parsed[rawJob].(map[string]interface{})
@@ -251,31 +424,63 @@ func (c *Crawler) parseTriggers(file []byte) ([]RawTrigger, error) {
 
 		switch t := rawTrigger.(type) {
 		case string:
-			triggers = append(triggers, RawTrigger{Project: t})
+			triggers = append(triggers, RawTrigger{Job: rawJob, Project: t})
 		case map[string]interface{}:
-			println(t["include"])
 			trigger, err := c.parseTriggerMap(t)
 			if err != nil {
 				c.logger.Warn().
 					Err(err).
 					Str("CIFileKey", rawJob).
 					Msg("could not parse contents of trigger")
+				continue
 			}
+			trigger.Job = rawJob
 			triggers = append(triggers, trigger)
 		}
 	}
 
-	return triggers, nil
+	return triggers
 }
 
+// parseTriggerMap parses the map form of `trigger:`. The `include` of a child
+// pipeline can be a single file or a list of includes, in the list every
+// kind of include as well as `artifact` includes of dynamic pipelines are allowed.
 func (c *Crawler) parseTriggerMap(input map[string]interface{}) (RawTrigger, error) {
 	t := RawTrigger{
-		Include: extractFieldFromMap("include", input),
-		Project: extractFieldFromMap("project", input),
-		Branch:  extractFieldFromMap("branch", input),
+		Project:  extractFieldFromMap("project", input),
+		Branch:   extractFieldFromMap("branch", input),
+		Strategy: extractFieldFromMap("strategy", input),
+	}
+
+	if forward, ok := input["forward"].(map[string]interface{}); ok {
+		t.Forward = forward
+	}
+
+	rawIncludes := make([]interface{}, 0)
+	switch i := input["include"].(type) {
+	case string, map[string]interface{}:
+		rawIncludes = append(rawIncludes, i)
+	case []interface{}:
+		rawIncludes = i
+	}
+
+	for _, rawInclude := range rawIncludes {
+		switch i := rawInclude.(type) {
+		case string:
+			t.Includes = append(t.Includes, RemoteInclude{Local: i})
+		case map[string]interface{}:
+			include, err := c.parseIncludeMap(i)
+			if err != nil {
+				c.logger.Warn().
+					Err(err).
+					Msg("failed to parse trigger include")
+				continue
+			}
+			t.Includes = append(t.Includes, include)
+		}
 	}
 
-	if t.Include == "" && t.Project == "" && t.Branch == "" {
+	if len(t.Includes) == 0 && t.Project == "" && t.Branch == "" {
 		return RawTrigger{}, errors.New("trigger map is not parseable")
 	}
 
@@ -296,15 +501,17 @@ func extractFieldFromMap(fieldName string, in map[string]interface{}) string {
 	return sField
 }
 
-func (c *Crawler) enrichTriggers(triggers []RawTrigger, projectPathWithNameSpace string) []RawTrigger {
+// enrichTriggers sets the default ref of multi-project triggers and resolves the
+// includes of child pipelines the same way enrichIncludes does for includes.
+func (c *Crawler) enrichTriggers(triggers []RawTrigger, defaultBranch, projectPathWithNameSpace string) []RawTrigger {
 	enrichedTriggers := make([]RawTrigger, 0)
 	for _, t := range triggers {
-		if t.Branch == "" {
+		if t.Branch == "" && t.Project != "" {
 			t.Branch = c.config.DefaultRefName
 		}
 
-		if t.Include != "" && t.Project == "" {
-			t.Project = projectPathWithNameSpace	
+		if len(t.Includes) > 0 {
+			t.Includes = c.enrichIncludes(t.Includes, defaultBranch, projectPathWithNameSpace, c.config.DefaultRefName)
 		}
 		enrichedTriggers = append(enrichedTriggers, t)
 	}
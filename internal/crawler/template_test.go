@@ -17,14 +17,82 @@ func (ns NilStorage) CreateProjectNode(ctx context.Context, projectPath string)
 	return nil
 }
 
+func (ns NilStorage) CreateRemoteFileNode(ctx context.Context, url string) error {
+	return nil
+}
+
+func (ns NilStorage) CreateTemplateNode(ctx context.Context, name string) error {
+	return nil
+}
+
+func (ns NilStorage) CreateFileNode(ctx context.Context, file storage.File) error {
+	return nil
+}
+
+func (ns NilStorage) CreateInputMismatchEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) CreateJobNode(ctx context.Context, job storage.Job) error {
+	return nil
+}
+
+func (ns NilStorage) CreateExtendsEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) CreateReferenceEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
 func (ns NilStorage) CreateIncludeEdge(ctx context.Context, include storage.Edge) error {
 	return nil
 }
 
+func (ns NilStorage) CreateUnresolvedNode(ctx context.Context, name string) error {
+	return nil
+}
+
+func (ns NilStorage) CreateComponentIncludeEdge(ctx context.Context, include storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) CreateNeedsArtifactsEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
 func (ns NilStorage) CreateTriggerEdge(ctx context.Context, include storage.Edge) error {
 	return nil
 }
 
+func (ns NilStorage) CreateDynamicPipelineNode(ctx context.Context, pipeline storage.DynamicPipeline) error {
+	return nil
+}
+
+func (ns NilStorage) CreateChildPipelineEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) CreateImageNode(ctx context.Context, image storage.Image) error {
+	return nil
+}
+
+func (ns NilStorage) CreateUsesImageEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) CreateMissingProjectNode(ctx context.Context, project, reason string) error {
+	return nil
+}
+
+func (ns NilStorage) CreateBrokenIncludeEdge(ctx context.Context, edge storage.Edge) error {
+	return nil
+}
+
+func (ns NilStorage) RemoveProjectEdges(ctx context.Context, project string, refs []string) error {
+	return nil
+}
+
 func (ns NilStorage) RemoveAll(ctx context.Context) error {
 	return nil
 }
@@ -40,21 +108,73 @@ func TestCrawlerParseTriggers(t *testing.T) {
 		t.Fatalf("failed to initialse crawler: %s", err)
 	}
 
-	triggers, err := crawler.parseTriggers(testFile)
+	parsed, err := crawler.UnmarshalCIFile(testFile)
 	if err != nil {
 		t.Fatalf("failed to parse triggers: %s", err)
 	}
+	triggers := crawler.parseTriggers(parsed)
 
 	expectedTriggers := []RawTrigger{
-		{Project: "test/trigger"},
-		{Project: "project/trigger"},
-		{Project: "project/trigger", Branch: "branch"},
-		{Include: "some-child/pipeline.yml"},
+		{Job: "string-trigger", Project: "test/trigger"},
+		{Job: "project-trigger", Project: "project/trigger"},
+		{Job: "project-branch-trigger", Project: "project/trigger", Branch: "branch"},
+		{Job: "include-trigger", Includes: []RemoteInclude{{Local: "some-child/pipeline.yml"}}},
+		{
+			Job: "list-include-trigger",
+			Includes: []RemoteInclude{
+				{Local: "child/build.yml"},
+				{Project: "my-group/pipelines", Files: StringArray{"child/deploy.yml"}, Ref: "v1.0.0"},
+			},
+			Strategy: "depend",
+			Forward:  map[string]interface{}{"pipeline_variables": true},
+		},
+		{
+			Job:      "dynamic-trigger",
+			Includes: []RemoteInclude{{Artifact: "generated-config.yml", Job: "generate-config"}},
+		},
 	}
 
 	assert.ElementsMatch(t, expectedTriggers, triggers)
 }
 
+func TestCrawlerEnrichTriggers(t *testing.T) {
+	crawler, err := New(&Config{DefaultRefName: "main"}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	triggers := crawler.enrichTriggers([]RawTrigger{
+		{Job: "multi-project", Project: "other/project"},
+		{Job: "child", Includes: []RemoteInclude{{Local: "/child.yml"}}},
+		{Job: "dynamic", Includes: []RemoteInclude{{Artifact: "generated.yml", Job: "generate"}}},
+	}, "develop", "my-group/project")
+
+	expectedTriggers := []RawTrigger{
+		{Job: "multi-project", Project: "other/project", Branch: "main"},
+		{
+			Job:      "child",
+			Includes: []RemoteInclude{{Local: "/child.yml", Project: "my-group/project", Files: StringArray{"/child.yml"}, Ref: "develop"}},
+		},
+		{Job: "dynamic", Includes: []RemoteInclude{{Artifact: "generated.yml", Job: "generate"}}},
+	}
+
+	assert.Equal(t, expectedTriggers, triggers)
+}
+
+func TestRawTriggerEdgeProperties(t *testing.T) {
+	trigger := RawTrigger{
+		Job:      "deploy",
+		Strategy: "depend",
+		Forward:  map[string]interface{}{"yaml_variables": false},
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"job":                    "deploy",
+		"strategy":               "depend",
+		"forward.yaml_variables": false,
+	}, trigger.edgeProperties())
+}
+
 func TestCrawlerParseIncludes(t *testing.T) {
 	testFile, err := os.ReadFile("../../test-files/gitlab-ci-includes.yaml")
 	if err != nil {
@@ -66,7 +186,12 @@ func TestCrawlerParseIncludes(t *testing.T) {
 		t.Fatalf("failed to initialse crawler: %s", err)
 	}
 
-	triggers, err := crawler.parseIncludes(testFile)
+	parsed, err := crawler.UnmarshalCIFile(testFile)
+	if err != nil {
+		t.Fatalf("failed to parse includes: %s", err)
+	}
+
+	triggers, err := crawler.parseIncludes(parsed)
 	if err != nil {
 		t.Fatalf("failed to parse triggers: %s", err)
 	}
@@ -74,7 +199,80 @@ func TestCrawlerParseIncludes(t *testing.T) {
 	expectedIncludes := []RemoteInclude{
 		{Local: "ci/examples/ci.yml"},
 		{Project: "my-group/project", Files: StringArray{"tmp.yml"}},
+		{Remote: "https://templates.example.com/ci/build.yml"},
+		{Remote: "https://templates.example.com/ci/test.yml"},
+		{
+			Component: "gitlab.example.com/my-group/components/sast@1.2",
+			Inputs:    map[string]interface{}{"stage": "test"},
+		},
+		{
+			Local: "ci/merge-requests.yml",
+			Rules: []interface{}{
+				map[string]interface{}{"if": `$CI_PIPELINE_SOURCE == "merge_request_event"`},
+			},
+		},
 	}
 
 	assert.ElementsMatch(t, expectedIncludes, triggers)
 }
+
+func TestRemoteIncludeEdgeProperties(t *testing.T) {
+	rules := []interface{}{
+		map[string]interface{}{"if": `$CI_PIPELINE_SOURCE == "merge_request_event"`},
+	}
+
+	include := RemoteInclude{
+		Component: "gitlab.example.com/my-group/components/sast@1.2",
+		Rules:     rules,
+		Inputs:    map[string]interface{}{"stage": "test", "allow_failure": true},
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"conditional":          true,
+		"rules":                rules,
+		"inputs.stage":         "test",
+		"inputs.allow_failure": true,
+	}, include.edgeProperties())
+
+	assert.Equal(t, map[string]interface{}{"conditional": false}, RemoteInclude{Local: "ci.yml"}.edgeProperties())
+}
+
+func TestParseCIConfigPath(t *testing.T) {
+	testData := []struct {
+		Name string
+		In   string
+		Out  RemoteInclude
+	}{
+		{
+			Name: "Default",
+			In:   "",
+			Out:  RemoteInclude{Local: ".gitlab-ci.yml"},
+		},
+		{
+			Name: "LocalFile",
+			In:   "ci/pipeline.yml",
+			Out:  RemoteInclude{Local: "ci/pipeline.yml"},
+		},
+		{
+			Name: "ExternalProject",
+			In:   "pipeline.yml@group/central-config",
+			Out:  RemoteInclude{Project: "group/central-config", Files: StringArray{"pipeline.yml"}},
+		},
+		{
+			Name: "ExternalProjectWithRef",
+			In:   "ci/pipeline.yml@group/sub/central-config:v1.0.0",
+			Out:  RemoteInclude{Project: "group/sub/central-config", Files: StringArray{"ci/pipeline.yml"}, Ref: "v1.0.0"},
+		},
+		{
+			Name: "Remote",
+			In:   "https://example.com/generate/ci-config",
+			Out:  RemoteInclude{Remote: "https://example.com/generate/ci-config"},
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			assert.Equal(t, td.Out, parseCIConfigPath(td.In))
+		})
+	}
+}
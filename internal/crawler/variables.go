@@ -0,0 +1,260 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+)
+
+// Variables maps CI/CD variable names to their values.
+type Variables map[string]string
+
+// ciVariables holds every variable the crawler knows about while parsing the
+// files of one pipeline. Lookups follow GitLab's precedence, project and
+// group variables win over the `variables:` of the CI files which in turn
+// win over the predefined variables.
+// See https://docs.gitlab.com/ee/ci/variables/#cicd-variable-precedence
+type ciVariables struct {
+	predefined Variables
+	file       Variables
+	settings   Variables
+}
+
+func (v *ciVariables) lookup(name string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+
+	for _, vars := range []Variables{v.settings, v.file, v.predefined} {
+		if val, ok := vars[name]; ok {
+			return val, true
+		}
+	}
+
+	return "", false
+}
+
+// withFileVariables returns a copy of the variables with the top-level
+// `variables:` block of a CI file added. Values that reference other
+// variables are expanded on the way in.
+func (v *ciVariables) withFileVariables(fileVars Variables) *ciVariables {
+	if len(fileVars) == 0 {
+		return v
+	}
+
+	merged := &ciVariables{file: make(Variables)}
+	if v != nil {
+		merged.predefined = v.predefined
+		merged.settings = v.settings
+		for k, val := range v.file {
+			merged.file[k] = val
+		}
+	}
+
+	for k, val := range fileVars {
+		merged.file[k], _ = v.expand(val)
+	}
+
+	return merged
+}
+
+// expand replaces `$VAR` and `${VAR}` references inside s with their values.
+// Unknown variables are left in place and reported by returning false so
+// callers can mark what they store as unresolved instead of failing.
+// `$$` is GitLab's escape for a literal `$`.
+func (v *ciVariables) expand(s string) (string, bool) {
+	if !strings.Contains(s, "$") {
+		return s, true
+	}
+
+	resolved := true
+	expanded := os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		val, ok := v.lookup(name)
+		if !ok {
+			resolved = false
+			return "$" + name
+		}
+		return val
+	})
+
+	return expanded, resolved
+}
+
+// predefinedVariables derives the predefined variables the crawler can know
+// about from the project and ref whose pipeline is being crawled.
+// See https://docs.gitlab.com/ee/ci/variables/predefined_variables.html
+func predefinedVariables(gitlabHost string, project gitlab.Project, ref pipelineRef) Variables {
+	namespace := path.Dir(project.PathWithNamespace)
+	rootNamespace, _, _ := strings.Cut(project.PathWithNamespace, "/")
+
+	vars := Variables{
+		"CI_PROJECT_ID":             strconv.Itoa(project.ID),
+		"CI_PROJECT_PATH":           project.PathWithNamespace,
+		"CI_PROJECT_NAME":           path.Base(project.PathWithNamespace),
+		"CI_PROJECT_NAMESPACE":      namespace,
+		"CI_PROJECT_ROOT_NAMESPACE": rootNamespace,
+		"CI_DEFAULT_BRANCH":         project.DefaultBranch,
+		"CI_COMMIT_REF_NAME":        ref.name,
+		"CI_CONFIG_PATH":            project.CIConfigPath,
+	}
+
+	if vars["CI_CONFIG_PATH"] == "" {
+		vars["CI_CONFIG_PATH"] = gitlabCIFileName
+	}
+
+	if ref.tag {
+		vars["CI_COMMIT_TAG"] = ref.name
+	} else {
+		vars["CI_COMMIT_BRANCH"] = ref.name
+	}
+
+	u, err := url.Parse(gitlabHost)
+	if err == nil && u.Host != "" {
+		serverURL := strings.TrimSuffix(u.String(), "/")
+		vars["CI_SERVER_URL"] = serverURL
+		vars["CI_SERVER_HOST"] = u.Hostname()
+		vars["CI_SERVER_FQDN"] = u.Host
+		vars["CI_SERVER_PROTOCOL"] = u.Scheme
+		vars["CI_API_V4_URL"] = serverURL + "/api/v4"
+		vars["CI_PROJECT_URL"] = serverURL + "/" + project.PathWithNamespace
+	}
+
+	return vars
+}
+
+// pipelineVariables sets up the variables for the pipeline of the given project
+// at the given ref. If ResolveCIVariables is set the project's and its groups'
+// CI/CD settings variables are fetched as well.
+func (c *Crawler) pipelineVariables(ctx context.Context, project gitlab.Project, ref pipelineRef) *ciVariables {
+	vars := &ciVariables{
+		predefined: predefinedVariables(c.config.GitlabHost, project, ref),
+	}
+
+	if !c.config.ResolveCIVariables {
+		return vars
+	}
+
+	settings, err := c.settingsVariables(ctx, project)
+	if err != nil {
+		c.logger.Warn().
+			Err(err).
+			Str("Project", project.PathWithNamespace).
+			Msg("failed to get CI/CD variables, continuing without them")
+	}
+	vars.settings = settings
+
+	return vars
+}
+
+// settingsVariables collects the variables from the project and all of its parent
+// groups, the closest definition of a variable wins.
+// Missing permissions on one of the levels are not an error, that level is skipped.
+func (c *Crawler) settingsVariables(ctx context.Context, project gitlab.Project) (Variables, error) {
+	vars := make(Variables)
+
+	groups := strings.Split(path.Dir(project.PathWithNamespace), "/")
+	for i := range groups {
+		groupVars, err := c.gitlabClient.GetGroupVariables(ctx, strings.Join(groups[:i+1], "/"))
+		if err != nil {
+			if errors.Is(err, gitlab.ErrVariablesNotAccessible) {
+				continue
+			}
+			return vars, fmt.Errorf("failed to get group variables: %w", err)
+		}
+		addSettingsVariables(vars, groupVars)
+	}
+
+	projectVars, err := c.gitlabClient.GetProjectVariables(ctx, project.ID)
+	if err != nil {
+		if errors.Is(err, gitlab.ErrVariablesNotAccessible) {
+			return vars, nil
+		}
+		return vars, fmt.Errorf("failed to get project variables: %w", err)
+	}
+	addSettingsVariables(vars, projectVars)
+
+	return vars, nil
+}
+
+func addSettingsVariables(vars Variables, settingsVars []gitlab.Variable) {
+	for _, v := range settingsVars {
+		// Only variables available to every environment can be used in
+		// includes, file variables hold a file's content and not a value.
+		if v.EnvironmentScope != "*" || v.VariableType != "env_var" {
+			continue
+		}
+		vars[v.Key] = v.Value
+	}
+}
+
+// expandIncludes expands the variables in all fields of the includes that are used
+// to find the included files.
+func (c *Crawler) expandIncludes(includes []RemoteInclude, vars *ciVariables) []RemoteInclude {
+	expanded := make([]RemoteInclude, len(includes))
+	for i, include := range includes {
+		resolved := true
+		expand := func(s string) string {
+			e, ok := vars.expand(s)
+			resolved = resolved && ok
+			return e
+		}
+
+		include.Project = expand(include.Project)
+		include.Ref = expand(include.Ref)
+		include.Local = expand(include.Local)
+		include.Remote = expand(include.Remote)
+		include.Template = expand(include.Template)
+		include.Component = expand(include.Component)
+		include.Artifact = expand(include.Artifact)
+
+		files := make(StringArray, len(include.Files))
+		for j, f := range include.Files {
+			files[j] = expand(f)
+		}
+		if include.Files != nil {
+			include.Files = files
+		}
+
+		if !resolved {
+			c.logger.Debug().
+				Str("Project", include.Project).
+				Str("Files", strings.Join(include.Files, ",")).
+				Str("Local", include.Local).
+				Str("Remote", include.Remote).
+				Str("Component", include.Component).
+				Msg("include contains variables that could not be resolved")
+		}
+
+		include.Unresolved = !resolved
+		expanded[i] = include
+	}
+	return expanded
+}
+
+// expandTriggers expands the variables in the target of the triggers, the
+// includes of child pipelines carry their own Unresolved flag.
+func (c *Crawler) expandTriggers(triggers []RawTrigger, vars *ciVariables) []RawTrigger {
+	expanded := make([]RawTrigger, len(triggers))
+	for i, t := range triggers {
+		var projectOK, branchOK bool
+		t.Project, projectOK = vars.expand(t.Project)
+		t.Branch, branchOK = vars.expand(t.Branch)
+		t.Unresolved = !projectOK || !branchOK
+		if len(t.Includes) > 0 {
+			t.Includes = c.expandIncludes(t.Includes, vars)
+		}
+		expanded[i] = t
+	}
+	return expanded
+}
@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCIVariablesExpand(t *testing.T) {
+	vars := &ciVariables{
+		predefined: predefinedVariables("https://gitlab.example.com", gitlab.Project{
+			ID:                42,
+			DefaultBranch:     "main",
+			PathWithNamespace: "my-group/sub/project",
+		}, pipelineRef{name: "main"}),
+		settings: Variables{"TEMPLATE_PROJECT": "platform/ci"},
+	}
+	vars = vars.withFileVariables(Variables{
+		"TEMPLATE_REF":     "$CI_DEFAULT_BRANCH",
+		"TEMPLATE_PROJECT": "overridden/by-settings",
+	})
+
+	testData := []struct {
+		Name     string
+		In       string
+		Out      string
+		Resolved bool
+	}{
+		{Name: "NoVariables", In: "templates/build.yml", Out: "templates/build.yml", Resolved: true},
+		{Name: "Predefined", In: "/templates/$CI_PROJECT_NAME.yml", Out: "/templates/project.yml", Resolved: true},
+		{Name: "Braces", In: "${CI_PROJECT_NAMESPACE}/ci", Out: "my-group/sub/ci", Resolved: true},
+		{Name: "FileVariableReferencingPredefined", In: "$TEMPLATE_REF", Out: "main", Resolved: true},
+		{Name: "SettingsWinOverFile", In: "$TEMPLATE_PROJECT", Out: "platform/ci", Resolved: true},
+		{Name: "Server", In: "$CI_SERVER_FQDN/components/sast", Out: "gitlab.example.com/components/sast", Resolved: true},
+		{Name: "Escaped", In: "$$CI_PROJECT_NAME", Out: "$CI_PROJECT_NAME", Resolved: true},
+		{Name: "Unknown", In: "$UNKNOWN/ci", Out: "$UNKNOWN/ci", Resolved: false},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			out, resolved := vars.expand(td.In)
+			assert.Equal(t, td.Out, out)
+			assert.Equal(t, td.Resolved, resolved)
+		})
+	}
+}
+
+func TestCrawlerParseVariables(t *testing.T) {
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	parsed, err := crawler.UnmarshalCIFile([]byte(`
+variables:
+  TEMPLATE_PROJECT: platform/ci
+  RETRIES: 3
+  TEMPLATE_REF:
+    value: v1.0.0
+    description: the template version
+`))
+	if err != nil {
+		t.Fatalf("failed to parse variables: %s", err)
+	}
+	vars := crawler.parseVariables(parsed)
+
+	assert.Equal(t, Variables{
+		"TEMPLATE_PROJECT": "platform/ci",
+		"RETRIES":          "3",
+		"TEMPLATE_REF":     "v1.0.0",
+	}, vars)
+}
+
+func TestCrawlerExpandIncludes(t *testing.T) {
+	crawler, err := New(&Config{}, zerolog.Logger{}, NilStorage{})
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	vars := &ciVariables{file: Variables{"TEMPLATE_PROJECT": "platform/ci"}}
+
+	includes := crawler.expandIncludes([]RemoteInclude{
+		{Project: "$TEMPLATE_PROJECT", Files: StringArray{"build.yml"}, Ref: "v1"},
+		{Project: "platform/ci", Files: StringArray{"$UNKNOWN.yml"}},
+	}, vars)
+
+	assert.Equal(t, []RemoteInclude{
+		{Project: "platform/ci", Files: StringArray{"build.yml"}, Ref: "v1"},
+		{Project: "platform/ci", Files: StringArray{"$UNKNOWN.yml"}, Unresolved: true},
+	}, includes)
+}
+
+// projectNodeStorage keeps the project and unresolved nodes written by the crawler.
+type projectNodeStorage struct {
+	includeEdgeStorage
+	projects   []string
+	unresolved []string
+}
+
+func (s *projectNodeStorage) CreateProjectNode(ctx context.Context, projectPath string) error {
+	s.projects = append(s.projects, projectPath)
+	return nil
+}
+
+func (s *projectNodeStorage) CreateUnresolvedNode(ctx context.Context, name string) error {
+	s.unresolved = append(s.unresolved, name)
+	return nil
+}
+
+func TestCrawlerUnresolvedProjectIsNoProject(t *testing.T) {
+	store := &projectNodeStorage{}
+	crawler, err := New(&Config{}, zerolog.Logger{}, store)
+	if err != nil {
+		t.Fatalf("failed to initialse crawler: %s", err)
+	}
+
+	source := projectSource(gitlab.Project{ID: 1, PathWithNamespace: "team/app", DefaultBranch: "main"}, ".gitlab-ci.yml", nil)
+	for _, include := range []RemoteInclude{
+		{Project: "$UPSTREAM_PROJECT", Files: StringArray{"build.yml"}, Ref: "v1", Unresolved: true},
+		{Project: "platform/ci", Files: StringArray{"$UNKNOWN.yml"}, Unresolved: true},
+	} {
+		assert.NoError(t, crawler.traverseIncludes(context.TODO(), source, include))
+	}
+
+	assert.Equal(t, []string{"platform/ci"}, store.projects)
+	assert.Equal(t, []string{"$UPSTREAM_PROJECT"}, store.unresolved)
+	assert.Equal(t, storage.NodeTypeUnresolved, store.edges[0].TargetType)
+	assert.Equal(t, storage.NodeTypeProject, store.edges[1].TargetType)
+}
@@ -1,6 +1,7 @@
 package gitlab
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -28,7 +29,11 @@ type Client struct {
 	Host     string
 	Token    string
 	HTTPDoer HTTPDoer
-	Logger   zerolog.Logger
+	// SendHTTPDoer sends the requests that create branches, commits and merge
+	// requests. They are not idempotent, so it must not retry them. HTTPDoer
+	// is used if it is not set.
+	SendHTTPDoer HTTPDoer
+	Logger       zerolog.Logger
 }
 
 type HTTPDoer interface {
@@ -41,8 +46,30 @@ type Project struct {
 	ID                int    `json:"id"`
 	DefaultBranch     string `json:"default_branch"`
 	PathWithNamespace string `json:"path_with_namespace"`
+	CIConfigPath      string `json:"ci_config_path"`
+	// LastActivityAt is updated by GitLab at most once an hour,
+	// see https://docs.gitlab.com/ee/api/projects.html#list-all-projects
+	LastActivityAt time.Time `json:"last_activity_at"`
+	Archived       bool      `json:"archived"`
+	Visibility     string    `json:"visibility"`
+	Topics         []string  `json:"topics"`
+	Namespace      Namespace `json:"namespace"`
+	// ForkedFromProject is only set for forks.
+	ForkedFromProject *Project `json:"forked_from_project"`
 }
 
+// Namespace is the group or user a project belongs to.
+type Namespace struct {
+	Kind     string `json:"kind"`
+	FullPath string `json:"full_path"`
+}
+
+// The kinds of namespaces, projects in user namespaces are personal projects.
+const (
+	NamespaceKindGroup = "group"
+	NamespaceKindUser  = "user"
+)
+
 // NewClient sets up a client struct for all relevant GitLab auth
 // you can give it a custom http.Client as well for things like
 // timeouts.
@@ -55,19 +82,34 @@ func NewClient(host, token string, httpDoer HTTPDoer, logger zerolog.Logger) *Cl
 	}
 }
 
+var (
+	ErrProjectNotFound  = errors.New("project was not found")
+	ErrProjectForbidden = errors.New("access to project is forbidden")
+)
+
+// GetProjectFromPath gets a single project by its full path, it returns
+// ErrProjectNotFound or ErrProjectForbidden if the token cannot see the project.
 func (c *Client) GetProjectFromPath(ctx context.Context, projectPath string) (Project, error) {
 	requestURL := fmt.Sprintf("%s/%s/projects/%s", c.Host, gitLabAPIPath, url.PathEscape(projectPath))
 	resp, err := c.callGitLabAPI(ctx, requestURL)
 	if err != nil {
 		return Project{}, fmt.Errorf("failed to get project: %w", err)
 	}
-	defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := readHTTPBody(resp.Body)
 	if err != nil {
 		return Project{}, fmt.Errorf("failed to parse response body: %w", err)
 	}
 
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Project{}, fmt.Errorf("%s: %w", projectPath, ErrProjectNotFound)
+	case resp.StatusCode == http.StatusForbidden:
+		return Project{}, fmt.Errorf("%s: %w", projectPath, ErrProjectForbidden)
+	case resp.StatusCode > 299:
+		return Project{}, fmt.Errorf("got bad response %s: %s", resp.Status, string(bodyBytes))
+	}
+
 	var p Project
 	err = json.Unmarshal(bodyBytes, &p)
 	if err != nil {
@@ -77,12 +119,94 @@ func (c *Client) GetProjectFromPath(ctx context.Context, projectPath string) (Pr
 	return p, nil
 }
 
+// Group is a minimalist representation of a GitLab group
+// from https://docs.gitlab.com/ee/api/groups.html#details-of-a-group
+type Group struct {
+	ID       int    `json:"id"`
+	FullPath string `json:"full_path"`
+}
+
+// GetGroup gets a single group by its ID or full path.
+func (c *Client) GetGroup(ctx context.Context, group string) (Group, error) {
+	requestURL := fmt.Sprintf("%s/%s/groups/%s?with_projects=false", c.Host, gitLabAPIPath, url.PathEscape(group))
+	resp, err := c.callGitLabAPI(ctx, requestURL)
+	if err != nil {
+		return Group{}, fmt.Errorf("failed to get group: %w", err)
+	}
+
+	bodyBytes, err := readHTTPBody(resp.Body)
+	if err != nil {
+		return Group{}, fmt.Errorf("failed to parse response body: %w", err)
+	}
+
+	if resp.StatusCode > 299 {
+		return Group{}, fmt.Errorf("failed to get group %s, got bad response %s: %s", group, resp.Status, string(bodyBytes))
+	}
+
+	var g Group
+	if err := json.Unmarshal(bodyBytes, &g); err != nil {
+		return Group{}, fmt.Errorf("failed to unmarshal group: %w", err)
+	}
+
+	return g, nil
+}
+
+// StreamOptions configures which projects StreamAllProjects streams.
+type StreamOptions struct {
+	PageSize int
+	// LastActivityAfter limits the stream to projects with activity after it when set.
+	LastActivityAfter time.Time
+	// StartURL continues an earlier stream at one of the page URLs it passed to OnPage,
+	// the projects on that page up to StartAfterID are left out.
+	StartURL     string
+	StartAfterID int
+	// Group limits the stream to the projects of the group with this ID and
+	// all of its subgroups, projects shared with the group are left out.
+	Group int
+	// OnPage is called with the URL and the projects of every page before
+	// the projects are sent into the channel.
+	OnPage func(pageURL string, projects []Project)
+	// Filter is applied by GitLab, the projects outside of it are never sent.
+	Filter ProjectFilter
+}
+
+// ProjectFilter holds the filters of the projects API. Archived is only
+// applied if set, Topics limits the stream to projects having all of them and
+// Membership and Owned to the projects of the user the token belongs to.
+type ProjectFilter struct {
+	Archived   *bool
+	Visibility string
+	Topics     []string
+	Membership bool
+	Owned      bool
+}
+
+// encode adds the filter to the query parameters of a request.
+func (f ProjectFilter) encode(queryParams url.Values) {
+	if f.Archived != nil {
+		queryParams.Set("archived", strconv.FormatBool(*f.Archived))
+	}
+	if f.Visibility != "" {
+		queryParams.Set("visibility", f.Visibility)
+	}
+	if len(f.Topics) > 0 {
+		queryParams.Set("topic", strings.Join(f.Topics, ","))
+	}
+	if f.Membership {
+		queryParams.Set("membership", "true")
+	}
+	if f.Owned {
+		queryParams.Set("owned", "true")
+	}
+}
+
 // StreamAllProjects iterates through all projects in a GitLab and streams them in batches of pageSize
 // into the projectsChan. Due to this you want to buffer the projectsChan channel to something like 2 x pageSize
 // depending on the speed and complexity of your consuming function.
 // The authentication check retries for max 30s using an exponential backoff but will exit immediately if a 401
 // has been returned. All calls after this are not retried and a failing API call will stop the stream currently.
-func (c *Client) StreamAllProjects(ctx context.Context, pageSize int, projectsChan chan<- Project) error {
+// Projects are streamed in ascending order of their ID, those of a single group if opts.Group is set.
+func (c *Client) StreamAllProjects(ctx context.Context, opts StreamOptions, projectsChan chan<- Project) error {
 	if err := c.checkGitLabauth(ctx); err != nil {
 		if errors.Is(err, ErrUnauthorised) {
 			return err
@@ -93,10 +217,28 @@ func (c *Client) StreamAllProjects(ctx context.Context, pageSize int, projectsCh
 	queryParams := url.Values{}
 	queryParams.Set("pagination", "keyset")
 	queryParams.Set("order_by", "id")
-	queryParams.Set("per_page", strconv.Itoa(pageSize))
-	queryParams.Set("simple", "true")
+	queryParams.Set("sort", "asc")
+	queryParams.Set("per_page", strconv.Itoa(opts.PageSize))
+	if !opts.LastActivityAfter.IsZero() {
+		queryParams.Set("last_activity_after", opts.LastActivityAfter.UTC().Format(time.RFC3339))
+	}
+	opts.Filter.encode(queryParams)
+	// We cannot ask for `simple=true` since the simple representation
+	// does not contain the `ci_config_path` of a project.
+
+	resource := "projects"
+	if opts.Group != 0 {
+		resource = fmt.Sprintf("groups/%d/projects", opts.Group)
+		queryParams.Set("include_subgroups", "true")
+		queryParams.Set("with_shared", "false")
+	}
 
-	nextRequestURL := fmt.Sprintf("%s/%s/%s?%s", c.Host, gitLabAPIPath, "projects", queryParams.Encode())
+	nextRequestURL := fmt.Sprintf("%s/%s/%s?%s", c.Host, gitLabAPIPath, resource, queryParams.Encode())
+	startAfterID := 0
+	if opts.StartURL != "" {
+		nextRequestURL = opts.StartURL
+		startAfterID = opts.StartAfterID
+	}
 
 	for nextRequestURL != "" {
 		resp, err := c.callGitLabAPI(ctx, nextRequestURL)
@@ -122,10 +264,35 @@ func (c *Client) StreamAllProjects(ctx context.Context, pageSize int, projectsCh
 			return nil
 		}
 
+		if startAfterID != 0 {
+			remaining := projects[:0]
+			for _, p := range projects {
+				if p.ID > startAfterID {
+					remaining = append(remaining, p)
+				}
+			}
+			projects = remaining
+			startAfterID = 0
+		}
+
+		if opts.OnPage != nil {
+			opts.OnPage(nextRequestURL, projects)
+		}
+
 		for _, p := range projects {
 			projectsChan <- p
 		}
 
+		// GitLab may answer group project listings with offset pagination
+		// whose last page links to others, but not to a next one.
+		if opts.Group != 0 {
+			nextRequestURL, err = nextPageURL(resp)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		lhs := resp.Header.Get("Link")
 		if lhs == "" {
 			return nil
@@ -166,7 +333,10 @@ func (re *RawFileError) Unwrap() error {
 	return re.Err
 }
 
-var ErrRawFileNotFound = errors.New("raw file was not found")
+var (
+	ErrRawFileNotFound  = errors.New("raw file was not found")
+	ErrRawFileForbidden = errors.New("access to raw file is forbidden")
+)
 
 // GetRawFileFromProject wraps around the raw file endpoint of GitLab helping to fetch files from specific repos
 // it will throw a typed ErrRawFileNotFound when it encounters a 404 response which you can errors.Is for to
@@ -211,6 +381,16 @@ func (c *Client) GetRawFileFromProject(ctx context.Context, projectID int, fileN
 			}
 		}
 
+		if resp.StatusCode == http.StatusForbidden {
+			return nil, &RawFileError{
+				Err:       ErrRawFileForbidden,
+				Msg:       "failed to get raw file",
+				File:      fileName,
+				Ref:       ref,
+				ProjectID: projectID,
+			}
+		}
+
 		return nil, &RawFileError{
 			Err:       nil,
 			Msg:       fmt.Sprintf("failed to get raw file: %s", string(bodyBytes)),
@@ -223,6 +403,455 @@ func (c *Client) GetRawFileFromProject(ctx context.Context, projectID int, fileN
 	return bodyBytes, nil
 }
 
+// GetFileBlobID returns the SHA of the blob of a file at ref without downloading
+// the file, files that do not exist have an empty blob ID.
+func (c *Client) GetFileBlobID(ctx context.Context, projectID int, fileName, ref string) (string, error) {
+	queryParams := url.Values{}
+	queryParams.Add("ref", ref)
+	requestFileName := url.PathEscape(strings.TrimPrefix(fileName, "/"))
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/files/%s?%s", c.Host, gitLabAPIPath, projectID, requestFileName, queryParams.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, requestURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to construct request to GitLab API: %w", err)
+	}
+
+	req.Header.Set(gitLabPrivateTokenHeader, c.Token)
+
+	resp, err := c.HTTPDoer.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call GitLab API on %s: %w", requestURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode > 299:
+		return "", fmt.Errorf("got bad response %s", resp.Status)
+	}
+
+	return resp.Header.Get("X-Gitlab-Blob-Id"), nil
+}
+
+var ErrCITemplateNotFound = errors.New("ci template was not found")
+
+type ciTemplate struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// GetCITemplate fetches the content of one of GitLab's built-in CI/CD templates
+// from https://docs.gitlab.com/ee/api/templates/gitlab_ci_ymls.html.
+// The key is the template name without the `.gitlab-ci.yml` suffix, e.g. `Jobs/Build`.
+func (c *Client) GetCITemplate(ctx context.Context, key string) ([]byte, error) {
+	requestURL := fmt.Sprintf("%s/%s/templates/gitlab_ci_ymls/%s", c.Host, gitLabAPIPath, url.PathEscape(key))
+	resp, err := c.callGitLabAPI(ctx, requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ci template: %w", err)
+	}
+
+	bodyBytes, err := readHTTPBody(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, ErrCITemplateNotFound)
+	}
+
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("failed to get ci template %s, got bad response %s: %s", key, resp.Status, string(bodyBytes))
+	}
+
+	var t ciTemplate
+	if err := json.Unmarshal(bodyBytes, &t); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ci template: %w", err)
+	}
+
+	return []byte(t.Content), nil
+}
+
+// treeEntry is a single file or directory from
+// https://docs.gitlab.com/ee/api/repositories.html#list-repository-tree
+type treeEntry struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// ListRepositoryFiles lists the paths of all files in the repository of a project
+// at the given ref, recursing into all subdirectories of dir. An empty dir lists the
+// whole repository.
+func (c *Client) ListRepositoryFiles(ctx context.Context, projectID int, dir, ref string) ([]string, error) {
+	queryParams := url.Values{}
+	queryParams.Set("pagination", "keyset")
+	queryParams.Set("per_page", "100")
+	queryParams.Set("recursive", "true")
+	queryParams.Set("ref", ref)
+	if dir != "" {
+		queryParams.Set("path", dir)
+	}
+
+	nextRequestURL := fmt.Sprintf("%s/%s/projects/%d/repository/tree?%s", c.Host, gitLabAPIPath, projectID, queryParams.Encode())
+
+	files := make([]string, 0)
+	for nextRequestURL != "" {
+		resp, err := c.callGitLabAPI(ctx, nextRequestURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repository tree: %w", err)
+		}
+
+		bodyBytes, err := readHTTPBody(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		// A path that does not exist in the repository is answered with a 404,
+		// there are no files matching in there.
+		if resp.StatusCode == http.StatusNotFound {
+			return files, nil
+		}
+
+		if resp.StatusCode > 299 {
+			return nil, fmt.Errorf("failed to list repository tree, got bad response %s: %s", resp.Status, string(bodyBytes))
+		}
+
+		entries := make([]treeEntry, 0)
+		if err := json.Unmarshal(bodyBytes, &entries); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal repository tree: %w", err)
+		}
+
+		for _, e := range entries {
+			if e.Type == "blob" {
+				files = append(files, e.Path)
+			}
+		}
+
+		nextRequestURL, err = nextPageURL(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// nextPageURL returns the URL of the next page of a keyset paginated response
+// or an empty string if this was the last page.
+func nextPageURL(resp *http.Response) (string, error) {
+	lhs := resp.Header.Get("Link")
+	if lhs == "" {
+		return "", nil
+	}
+
+	linkHeaders, err := parseLinkHeaders(lhs)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse link header: %w", err)
+	}
+
+	return getNextLinkFromLinkHeaders(linkHeaders).link, nil
+}
+
+// Branch is a branch of a repository from
+// https://docs.gitlab.com/ee/api/branches.html#list-repository-branches
+type Branch struct {
+	Name      string `json:"name"`
+	Protected bool   `json:"protected"`
+	Default   bool   `json:"default"`
+	Commit    Commit `json:"commit"`
+}
+
+// Tag is a tag of a repository from
+// https://docs.gitlab.com/ee/api/tags.html#list-project-repository-tags
+type Tag struct {
+	Name   string `json:"name"`
+	Commit Commit `json:"commit"`
+}
+
+// Commit is a single commit of a repository from
+// https://docs.gitlab.com/ee/api/commits.html#get-a-single-commit
+type Commit struct {
+	ID string `json:"id"`
+}
+
+// ListBranches lists all branches of the repository of a project.
+func (c *Client) ListBranches(ctx context.Context, projectID int) ([]Branch, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/branches?per_page=100", c.Host, gitLabAPIPath, projectID)
+
+	branches := make([]Branch, 0)
+	err := c.getAllPages(ctx, requestURL, func(page []byte) error {
+		var b []Branch
+		if err := json.Unmarshal(page, &b); err != nil {
+			return fmt.Errorf("failed to unmarshal branches: %w", err)
+		}
+		branches = append(branches, b...)
+		return nil
+	})
+
+	return branches, err
+}
+
+// ListTags lists all tags of the repository of a project, the most
+// recently updated tags come first.
+func (c *Client) ListTags(ctx context.Context, projectID int) ([]Tag, error) {
+	queryParams := url.Values{}
+	queryParams.Set("order_by", "updated")
+	queryParams.Set("sort", "desc")
+	queryParams.Set("per_page", "100")
+
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/tags?%s", c.Host, gitLabAPIPath, projectID, queryParams.Encode())
+
+	tags := make([]Tag, 0)
+	err := c.getAllPages(ctx, requestURL, func(page []byte) error {
+		var t []Tag
+		if err := json.Unmarshal(page, &t); err != nil {
+			return fmt.Errorf("failed to unmarshal tags: %w", err)
+		}
+		tags = append(tags, t...)
+		return nil
+	})
+
+	return tags, err
+}
+
+var ErrRefNotFound = errors.New("ref was not found in the repository")
+
+// GetBranch gets a single branch of the repository of a project, it returns
+// ErrRefNotFound if the branch does not exist.
+func (c *Client) GetBranch(ctx context.Context, projectPath, name string) (Branch, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%s/repository/branches/%s", c.Host, gitLabAPIPath, url.PathEscape(projectPath), url.PathEscape(name))
+
+	var b Branch
+	err := c.getRepositoryObject(ctx, requestURL, &b)
+	return b, err
+}
+
+// GetTag gets a single tag of the repository of a project, it returns
+// ErrRefNotFound if the tag does not exist.
+func (c *Client) GetTag(ctx context.Context, projectPath, name string) (Tag, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%s/repository/tags/%s", c.Host, gitLabAPIPath, url.PathEscape(projectPath), url.PathEscape(name))
+
+	var t Tag
+	err := c.getRepositoryObject(ctx, requestURL, &t)
+	return t, err
+}
+
+// GetCommit gets the commit a ref of the repository of a project points to, the
+// ref can be a branch, a tag, a commit SHA or `HEAD`. It returns ErrRefNotFound
+// if the ref does not exist.
+func (c *Client) GetCommit(ctx context.Context, projectPath, ref string) (Commit, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%s/repository/commits/%s", c.Host, gitLabAPIPath, url.PathEscape(projectPath), url.PathEscape(ref))
+
+	var commit Commit
+	err := c.getRepositoryObject(ctx, requestURL, &commit)
+	return commit, err
+}
+
+func (c *Client) getRepositoryObject(ctx context.Context, requestURL string, out interface{}) error {
+	resp, err := c.callGitLabAPI(ctx, requestURL)
+	if err != nil {
+		return err
+	}
+
+	bodyBytes, err := readHTTPBody(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrRefNotFound
+	}
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("got bad response %s: %s", resp.Status, string(bodyBytes))
+	}
+
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return nil
+}
+
+// CreateBranch creates a new branch in the repository of a project starting at ref.
+func (c *Client) CreateBranch(ctx context.Context, projectID int, branch, ref string) error {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/branches", c.Host, gitLabAPIPath, projectID)
+	return c.send(ctx, http.MethodPost, requestURL, map[string]string{
+		"branch": branch,
+		"ref":    ref,
+	}, nil)
+}
+
+// DeleteBranch removes a branch from the repository of a project.
+func (c *Client) DeleteBranch(ctx context.Context, projectID int, branch string) error {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/branches/%s", c.Host, gitLabAPIPath, projectID, url.PathEscape(branch))
+	return c.send(ctx, http.MethodDelete, requestURL, nil, nil)
+}
+
+// CommitAction is a single file change of a commit from
+// https://docs.gitlab.com/ee/api/commits.html#create-a-commit-with-multiple-files-and-actions
+type CommitAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	Content  string `json:"content"`
+}
+
+// CreateCommit commits the given file changes to an existing branch of a project.
+func (c *Client) CreateCommit(ctx context.Context, projectID int, branch, message string, actions []CommitAction) (Commit, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/repository/commits", c.Host, gitLabAPIPath, projectID)
+
+	var commit Commit
+	err := c.send(ctx, http.MethodPost, requestURL, map[string]interface{}{
+		"branch":         branch,
+		"commit_message": message,
+		"actions":        actions,
+	}, &commit)
+	return commit, err
+}
+
+// MergeRequestOptions are the fields of a new merge request from
+// https://docs.gitlab.com/ee/api/merge_requests.html#create-mr
+type MergeRequestOptions struct {
+	SourceBranch       string `json:"source_branch"`
+	TargetBranch       string `json:"target_branch"`
+	Title              string `json:"title"`
+	Description        string `json:"description"`
+	RemoveSourceBranch bool   `json:"remove_source_branch"`
+}
+
+// MergeRequest is a minimalist representation of a GitLab merge request.
+type MergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+// CreateMergeRequest opens a merge request in a project.
+func (c *Client) CreateMergeRequest(ctx context.Context, projectID int, opts MergeRequestOptions) (MergeRequest, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/merge_requests", c.Host, gitLabAPIPath, projectID)
+
+	var mr MergeRequest
+	err := c.send(ctx, http.MethodPost, requestURL, opts, &mr)
+	return mr, err
+}
+
+// send writes to the GitLab API and unmarshals the response into out if it is not nil.
+func (c *Client) send(ctx context.Context, method, requestURL string, body, out interface{}) error {
+	resp, err := c.sendToGitLabAPI(ctx, method, requestURL, body)
+	if err != nil {
+		return err
+	}
+
+	bodyBytes, err := readHTTPBody(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("got bad response %s: %s", resp.Status, string(bodyBytes))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(bodyBytes, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return nil
+}
+
+// getAllPages follows the `next` links of a paginated endpoint and hands the body
+// of every page to handlePage.
+func (c *Client) getAllPages(ctx context.Context, requestURL string, handlePage func(page []byte) error) error {
+	for requestURL != "" {
+		resp, err := c.callGitLabAPI(ctx, requestURL)
+		if err != nil {
+			return err
+		}
+
+		bodyBytes, err := readHTTPBody(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if resp.StatusCode > 299 {
+			return &responseError{statusCode: resp.StatusCode, status: resp.Status, body: string(bodyBytes)}
+		}
+
+		if err := handlePage(bodyBytes); err != nil {
+			return err
+		}
+
+		requestURL, err = nextPageURL(resp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// responseError is the error of a page that GitLab did not answer with a 2xx status.
+type responseError struct {
+	statusCode int
+	status     string
+	body       string
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("got bad response %s: %s", e.status, e.body)
+}
+
+// Variable is a CI/CD variable set in the settings of a project or group
+// from https://docs.gitlab.com/ee/api/project_level_variables.html
+type Variable struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	VariableType     string `json:"variable_type"`
+	EnvironmentScope string `json:"environment_scope"`
+}
+
+var ErrVariablesNotAccessible = errors.New("ci variables are not accessible, this needs at least the maintainer role")
+
+// GetProjectVariables lists the CI/CD variables of a project, only the first 100
+// variables are returned. It returns ErrVariablesNotAccessible for projects where
+// the token is lacking the permissions to read the variables.
+func (c *Client) GetProjectVariables(ctx context.Context, projectID int) ([]Variable, error) {
+	requestURL := fmt.Sprintf("%s/%s/projects/%d/variables?per_page=100", c.Host, gitLabAPIPath, projectID)
+	return c.getVariables(ctx, requestURL)
+}
+
+// GetGroupVariables lists the CI/CD variables of a group, it behaves like GetProjectVariables.
+func (c *Client) GetGroupVariables(ctx context.Context, groupPath string) ([]Variable, error) {
+	requestURL := fmt.Sprintf("%s/%s/groups/%s/variables?per_page=100", c.Host, gitLabAPIPath, url.PathEscape(groupPath))
+	return c.getVariables(ctx, requestURL)
+}
+
+func (c *Client) getVariables(ctx context.Context, requestURL string) ([]Variable, error) {
+	variables := make([]Variable, 0)
+	err := c.getAllPages(ctx, requestURL, func(page []byte) error {
+		var v []Variable
+		if err := json.Unmarshal(page, &v); err != nil {
+			return fmt.Errorf("failed to unmarshal variables: %w", err)
+		}
+		variables = append(variables, v...)
+		return nil
+	})
+
+	// GitLab answers with a 404 for groups that are really user namespaces
+	// and with a 403 when the token lacks the maintainer role.
+	var re *responseError
+	if errors.As(err, &re) && (re.statusCode == http.StatusForbidden || re.statusCode == http.StatusNotFound) {
+		return nil, ErrVariablesNotAccessible
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variables: %w", err)
+	}
+
+	return variables, nil
+}
+
 var ErrUnauthorised = errors.New("gitlab client is missing valid credentials")
 var ErrForbidden = errors.New("gitlan client is missing credentials to run, you need at least `read_api`")
 
@@ -262,11 +891,11 @@ func (c *Client) checkGitLabauth(ctx context.Context) error {
 		MaxInterval:         5 * time.Second,
 	}
 	_, err := backoff.Retry(
-			ctx,
-			call,
-			backoff.WithBackOff(eb),
-			backoff.WithMaxElapsedTime(30*time.Second),
-		)
+		ctx,
+		call,
+		backoff.WithBackOff(eb),
+		backoff.WithMaxElapsedTime(30*time.Second),
+	)
 	if err != nil {
 		if errors.Is(err, ErrUnauthorised) {
 			return err
@@ -301,6 +930,42 @@ func (c *Client) callGitLabAPI(ctx context.Context, url string) (*http.Response,
 	return resp, nil
 }
 
+// sendToGitLabAPI sends a JSON body to the GitLab API with the given method,
+// it is only used by the commands that change repositories. Requests without
+// a body are sent empty.
+func (c *Client) sendToGitLabAPI(ctx context.Context, method, url string, body interface{}) (*http.Response, error) {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		payload = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request to GitLab API: %w", err)
+	}
+
+	req.Header.Set(gitLabPrivateTokenHeader, c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	doer := c.SendHTTPDoer
+	if doer == nil {
+		doer = c.HTTPDoer
+	}
+
+	resp, err := doer.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call GitLab API on %s: %w", url, err)
+	}
+
+	return resp, nil
+}
+
 func readHTTPBody(bodyReader io.ReadCloser) ([]byte, error) {
 	defer bodyReader.Close()
 
@@ -5,6 +5,7 @@ import (
 	"github.com/rs/zerolog"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -89,3 +90,296 @@ func TestClient_GetRawFileFromProject(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_GetCITemplate(t *testing.T) {
+	testData := []struct {
+		Name   string
+		DoFunc func(r *http.Request) (*http.Response, error)
+		Out    []byte
+		Err    error
+	}{
+		{
+			Name: "ValidTemplate",
+			DoFunc: func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/api/v4/templates/gitlab_ci_ymls/Jobs%2FBuild", r.URL.EscapedPath())
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`{"name":"Jobs/Build","content":"build: {}"}`)),
+				}, nil
+			},
+			Out: []byte("build: {}"),
+			Err: nil,
+		},
+		{
+			Name: "TemplateNotFound",
+			DoFunc: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Not Found"}`)),
+				}, nil
+			},
+			Out: nil,
+			Err: ErrCITemplateNotFound,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			d := doer{
+				doFunc: td.DoFunc,
+			}
+			c := NewClient("https://example.com", "", &d, zerolog.Logger{})
+			bytes, err := c.GetCITemplate(context.TODO(), "Jobs/Build")
+
+			if td.Err != nil {
+				assert.ErrorIs(t, err, td.Err)
+			}
+			assert.Equal(t, td.Out, bytes)
+		})
+	}
+}
+
+func TestClient_ListTags(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"name":"v1.1.0"},{"name":"v1.0.0"}]`,
+		"2": `[{"name":"v0.9.0"}]`,
+	}
+
+	d := doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			assert.Equal(t, "/api/v4/projects/1/repository/tags", r.URL.Path)
+			assert.Equal(t, "updated", r.URL.Query().Get("order_by"))
+
+			page := r.URL.Query().Get("page")
+			if page == "" {
+				page = "1"
+			}
+
+			header := http.Header{}
+			if page == "1" {
+				header.Set("Link", `<https://example.com/api/v4/projects/1/repository/tags?order_by=updated&page=2>; rel="next"`)
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader(pages[page])),
+			}, nil
+		},
+	}
+
+	c := NewClient("https://example.com", "", &d, zerolog.Logger{})
+	tags, err := c.ListTags(context.TODO(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Tag{{Name: "v1.1.0"}, {Name: "v1.0.0"}, {Name: "v0.9.0"}}, tags)
+}
+
+func TestClient_GetProjectVariables(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"key":"TEMPLATE_PROJECT","value":"platform/ci"}]`,
+		"2": `[{"key":"TEMPLATE_REF","value":"v1.0.0"}]`,
+	}
+
+	d := doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path == "/api/v4/projects/2/variables" {
+				return &http.Response{
+					StatusCode: http.StatusForbidden,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"403 Forbidden"}`)),
+				}, nil
+			}
+
+			page := r.URL.Query().Get("page")
+			if page == "" {
+				page = "1"
+			}
+
+			header := http.Header{}
+			if page == "1" {
+				header.Set("Link", `<https://example.com/api/v4/projects/1/variables?per_page=100&page=2>; rel="next"`)
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader(pages[page])),
+			}, nil
+		},
+	}
+
+	c := NewClient("https://example.com", "", &d, zerolog.Logger{})
+	variables, err := c.GetProjectVariables(context.TODO(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Variable{
+		{Key: "TEMPLATE_PROJECT", Value: "platform/ci"},
+		{Key: "TEMPLATE_REF", Value: "v1.0.0"},
+	}, variables)
+
+	_, err = c.GetProjectVariables(context.TODO(), 2)
+	assert.ErrorIs(t, err, ErrVariablesNotAccessible)
+}
+
+func TestClient_GetBranch(t *testing.T) {
+	testData := []struct {
+		Name   string
+		DoFunc func(r *http.Request) (*http.Response, error)
+		Out    Branch
+		Err    error
+	}{
+		{
+			Name: "ValidBranch",
+			DoFunc: func(r *http.Request) (*http.Response, error) {
+				assert.Equal(t, "/api/v4/projects/platform%2Fci/repository/branches/release%2F1.x", r.URL.EscapedPath())
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`{"name":"release/1.x","protected":true,"commit":{"id":"8f3c1f0e"}}`)),
+				}, nil
+			},
+			Out: Branch{Name: "release/1.x", Protected: true, Commit: Commit{ID: "8f3c1f0e"}},
+		},
+		{
+			Name: "BranchNotFound",
+			DoFunc: func(r *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusNotFound,
+					Body:       io.NopCloser(strings.NewReader(`{"message":"404 Branch Not Found"}`)),
+				}, nil
+			},
+			Err: ErrRefNotFound,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			d := doer{
+				doFunc: td.DoFunc,
+			}
+			c := NewClient("https://example.com", "", &d, zerolog.Logger{})
+			branch, err := c.GetBranch(context.TODO(), "platform/ci", "release/1.x")
+
+			if td.Err != nil {
+				assert.ErrorIs(t, err, td.Err)
+			}
+			assert.Equal(t, td.Out, branch)
+		})
+	}
+}
+
+func TestClient_CreateBranchUsesSendHTTPDoer(t *testing.T) {
+	get := doer{doFunc: func(r *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected %s %s through the HTTPDoer", r.Method, r.URL.Path)
+		return nil, nil
+	}}
+
+	sent := make([]string, 0)
+	send := doer{doFunc: func(r *http.Request) (*http.Response, error) {
+		sent = append(sent, r.Method+" "+r.URL.EscapedPath())
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       io.NopCloser(strings.NewReader(`{}`)),
+		}, nil
+	}}
+
+	c := NewClient("https://example.com", "", &get, zerolog.Logger{})
+	c.SendHTTPDoer = &send
+
+	assert.NoError(t, c.CreateBranch(context.TODO(), 7, "bump/v2", "main"))
+	assert.NoError(t, c.DeleteBranch(context.TODO(), 7, "bump/v2"))
+	assert.Equal(t, []string{
+		"POST /api/v4/projects/7/repository/branches",
+		"DELETE /api/v4/projects/7/repository/branches/bump%2Fv2",
+	}, sent)
+}
+
+func TestClient_GetProjectFromPath(t *testing.T) {
+	testData := []struct {
+		Name   string
+		Status int
+		Body   string
+		Out    Project
+		Err    error
+	}{
+		{
+			Name:   "ValidProject",
+			Status: http.StatusOK,
+			Body:   `{"id":7,"default_branch":"main","path_with_namespace":"platform/ci"}`,
+			Out:    Project{ID: 7, DefaultBranch: "main", PathWithNamespace: "platform/ci"},
+		},
+		{
+			Name:   "ProjectNotFound",
+			Status: http.StatusNotFound,
+			Body:   `{"message":"404 Project Not Found"}`,
+			Err:    ErrProjectNotFound,
+		},
+		{
+			Name:   "ProjectForbidden",
+			Status: http.StatusForbidden,
+			Body:   `{"message":"403 Forbidden"}`,
+			Err:    ErrProjectForbidden,
+		},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Name, func(t *testing.T) {
+			d := doer{
+				doFunc: func(r *http.Request) (*http.Response, error) {
+					assert.Equal(t, "/api/v4/projects/platform%2Fci", r.URL.EscapedPath())
+					return &http.Response{
+						StatusCode: td.Status,
+						Body:       io.NopCloser(strings.NewReader(td.Body)),
+					}, nil
+				},
+			}
+			c := NewClient("https://example.com", "", &d, zerolog.Logger{})
+			project, err := c.GetProjectFromPath(context.TODO(), "platform/ci")
+
+			if td.Err != nil {
+				assert.ErrorIs(t, err, td.Err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, td.Out, project)
+		})
+	}
+}
+
+func TestClient_StreamAllProjectsFilter(t *testing.T) {
+	var query url.Values
+	d := &doer{
+		doFunc: func(r *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(r.URL.Path, "/projects") {
+				query = r.URL.Query()
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`[{"id":1,"archived":false,"topics":["ci"],"namespace":{"kind":"user"},"forked_from_project":{"id":2}}]`)),
+			}, nil
+		},
+	}
+
+	archived := false
+	c := NewClient("https://gitlab.example.com", "", d, zerolog.Logger{})
+	projects := make(chan Project, 1)
+	err := c.StreamAllProjects(context.TODO(), StreamOptions{
+		PageSize: 100,
+		Filter: ProjectFilter{
+			Archived:   &archived,
+			Visibility: "internal",
+			Topics:     []string{"ci", "go"},
+			Owned:      true,
+		},
+	}, projects)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "false", query.Get("archived"))
+	assert.Equal(t, "internal", query.Get("visibility"))
+	assert.Equal(t, "ci,go", query.Get("topic"))
+	assert.Equal(t, "true", query.Get("owned"))
+	assert.Empty(t, query.Get("membership"))
+
+	p := <-projects
+	assert.Equal(t, NamespaceKindUser, p.Namespace.Kind)
+	assert.Equal(t, 2, p.ForkedFromProject.ID)
+}
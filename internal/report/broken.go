@@ -0,0 +1,85 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// NamespaceBrokenIncludes holds the broken includes of every project in a
+// namespace, the owners of a namespace are the ones to be told about them.
+type NamespaceBrokenIncludes struct {
+	Namespace string          `json:"namespace"`
+	Includes  []BrokenInclude `json:"includes"`
+}
+
+// BrokenInclude is an include that cannot be read, the pipeline of Project on
+// SourceRef fails the next time it runs. IncludedBy is set if the include is
+// not in the project's own CI file but in a file included by it.
+type BrokenInclude struct {
+	Project    string   `json:"project"`
+	SourceRef  string   `json:"source_ref"`
+	Target     string   `json:"target"`
+	Ref        string   `json:"ref"`
+	Files      []string `json:"files,omitempty"`
+	Reason     string   `json:"reason"`
+	IncludedBy string   `json:"included_by,omitempty"`
+}
+
+// Broken lists every project with broken includes grouped by the namespace
+// the project lives in.
+func Broken(ctx context.Context, reader storage.Reader) ([]NamespaceBrokenIncludes, error) {
+	edges, err := reader.ListBrokenIncludes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broken includes: %w", err)
+	}
+
+	byNamespace := make(map[string][]BrokenInclude)
+	for _, e := range edges {
+		reason, _ := e.Properties["reason"].(string)
+		includedBy, _ := e.Properties["included_by"].(string)
+
+		namespace := namespaceOf(e.SourceProject)
+		byNamespace[namespace] = append(byNamespace[namespace], BrokenInclude{
+			Project:    e.SourceProject,
+			SourceRef:  e.SourceRef,
+			Target:     e.TargetProject,
+			Ref:        e.Ref,
+			Files:      e.Files,
+			Reason:     reason,
+			IncludedBy: includedBy,
+		})
+	}
+
+	namespaces := make([]NamespaceBrokenIncludes, 0, len(byNamespace))
+	for namespace, includes := range byNamespace {
+		sort.Slice(includes, func(i, j int) bool {
+			a, b := includes[i], includes[j]
+			if a.Project != b.Project {
+				return a.Project < b.Project
+			}
+			if a.SourceRef != b.SourceRef {
+				return a.SourceRef < b.SourceRef
+			}
+			return a.Target < b.Target
+		})
+		namespaces = append(namespaces, NamespaceBrokenIncludes{Namespace: namespace, Includes: includes})
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	return namespaces, nil
+}
+
+// namespaceOf returns the full path of the group or user a project belongs to.
+func namespaceOf(project string) string {
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		return project[:i]
+	}
+	return ""
+}
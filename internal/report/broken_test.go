@@ -0,0 +1,56 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroken(t *testing.T) {
+	reader := fakeReader{broken: []storage.Edge{
+		{SourceProject: "team/b", SourceRef: "main", TargetProject: "platform/ci", Ref: "v9.0.0", Files: []string{"build.yml"}, Properties: map[string]interface{}{"reason": storage.BrokenReasonRefMissing}},
+		{SourceProject: "team/a", SourceRef: "main", TargetProject: "gone/ci", Ref: "main", Properties: map[string]interface{}{"reason": storage.BrokenReasonProjectMissing}},
+		{SourceProject: "group/sub/c", SourceRef: "develop", TargetProject: "platform/ci", Ref: "v1.0.0", Files: []string{"lint.yml"}, Properties: map[string]interface{}{
+			"reason":      storage.BrokenReasonFileMissing,
+			"included_by": "platform/ci:build.yml@v1.0.0",
+		}},
+	}}
+
+	namespaces, err := Broken(context.TODO(), reader)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []NamespaceBrokenIncludes{
+		{
+			Namespace: "group/sub",
+			Includes: []BrokenInclude{
+				{Project: "group/sub/c", SourceRef: "develop", Target: "platform/ci", Ref: "v1.0.0", Files: []string{"lint.yml"}, Reason: storage.BrokenReasonFileMissing, IncludedBy: "platform/ci:build.yml@v1.0.0"},
+			},
+		},
+		{
+			Namespace: "team",
+			Includes: []BrokenInclude{
+				{Project: "team/a", SourceRef: "main", Target: "gone/ci", Ref: "main", Reason: storage.BrokenReasonProjectMissing},
+				{Project: "team/b", SourceRef: "main", Target: "platform/ci", Ref: "v9.0.0", Files: []string{"build.yml"}, Reason: storage.BrokenReasonRefMissing},
+			},
+		},
+	}, namespaces)
+}
+
+func TestWriteBrokenCSV(t *testing.T) {
+	namespaces := []NamespaceBrokenIncludes{{
+		Namespace: "team",
+		Includes: []BrokenInclude{
+			{Project: "team/a", SourceRef: "main", Target: "platform/ci", Ref: "v1.0.0", Files: []string{"build.yml", "test.yml"}, Reason: storage.BrokenReasonForbidden},
+		},
+	}}
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteBroken(&out, FormatCSV, namespaces))
+	assert.Equal(t, "namespace,project,source_ref,target,ref,files,reason,included_by\n"+
+		"team,team/a,main,platform/ci,v1.0.0,\"build.yml,test.yml\",no access,\n", out.String())
+
+	assert.Error(t, WriteBroken(&out, "xml", namespaces))
+}
@@ -0,0 +1,136 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// The output formats every report can be written in.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// WriteOutdated writes the outdated report in the given format. Tables and CSV
+// have one row per consumer, the JSON output is grouped by template project.
+func WriteOutdated(w io.Writer, format string, templates []TemplateVersions) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(templates)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{
+			"template", "latest", "consumer", "source_ref", "files", "component",
+			"ref", "version", "status", "major_behind", "minor_behind", "patch_behind",
+		}); err != nil {
+			return err
+		}
+
+		for _, t := range templates {
+			for _, c := range t.Consumers {
+				if err := cw.Write([]string{
+					t.Project, t.Latest, c.Project, c.SourceRef, strings.Join(c.Files, ","), c.Component,
+					c.Ref, c.Version, c.Status,
+					strconv.Itoa(c.MajorBehind), strconv.Itoa(c.MinorBehind), strconv.Itoa(c.PatchBehind),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		cw.Flush()
+		return cw.Error()
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, t := range templates {
+			latest := t.Latest
+			if latest == "" {
+				latest = "-"
+			}
+			fmt.Fprintf(tw, "%s\tlatest: %s\ttags: %s\n", t.Project, latest, strings.Join(t.Tags, ", "))
+			fmt.Fprintln(tw, "  CONSUMER\tSOURCE REF\tREF\tVERSION\tSTATUS\tDISTANCE")
+			for _, c := range t.Consumers {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", c.Project, c.SourceRef, c.Ref, c.Version, c.Status, c.distance())
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+// distance describes how far a consumer is behind in a way that reads well in a table.
+func (c Consumer) distance() string {
+	switch {
+	case c.MajorBehind > 0:
+		return fmt.Sprintf("%d major", c.MajorBehind)
+	case c.MinorBehind > 0:
+		return fmt.Sprintf("%d minor", c.MinorBehind)
+	case c.PatchBehind > 0:
+		return fmt.Sprintf("%d patch", c.PatchBehind)
+	default:
+		return ""
+	}
+}
+
+// WriteBroken writes the broken includes report in the given format, the table
+// has a section per namespace while CSV repeats the namespace on every row.
+func WriteBroken(w io.Writer, format string, namespaces []NamespaceBrokenIncludes) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(namespaces)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{
+			"namespace", "project", "source_ref", "target", "ref", "files", "reason", "included_by",
+		}); err != nil {
+			return err
+		}
+
+		for _, n := range namespaces {
+			for _, i := range n.Includes {
+				if err := cw.Write([]string{
+					n.Namespace, i.Project, i.SourceRef, i.Target, i.Ref, strings.Join(i.Files, ","), i.Reason, i.IncludedBy,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
+		cw.Flush()
+		return cw.Error()
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, n := range namespaces {
+			fmt.Fprintf(tw, "%s\tprojects: %d\n", n.Namespace, n.projects())
+			fmt.Fprintln(tw, "  PROJECT\tSOURCE REF\tTARGET\tREF\tFILES\tREASON\tINCLUDED BY")
+			for _, i := range n.Includes {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", i.Project, i.SourceRef, i.Target, i.Ref, strings.Join(i.Files, ","), i.Reason, i.IncludedBy)
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+}
+
+// projects counts the projects of a namespace with at least one broken include.
+func (n NamespaceBrokenIncludes) projects() int {
+	seen := make(map[string]struct{})
+	for _, i := range n.Includes {
+		seen[i.Project] = struct{}{}
+	}
+	return len(seen)
+}
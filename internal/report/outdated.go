@@ -0,0 +1,246 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/semver"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+)
+
+// The status of a consumer in the outdated report.
+const (
+	StatusUpToDate = "up-to-date"
+	StatusBehind   = "behind"
+	StatusBranch   = "pinned to branch"
+	// StatusUnknown is used for refs that do not match any released
+	// version, like missing refs or refs containing variables.
+	StatusUnknown = "unknown"
+)
+
+// TagLister lists the tags of a project.
+type TagLister interface {
+	ListProjectTags(ctx context.Context, projectPath string) ([]gitlab.Tag, error)
+}
+
+// GitLabTags lists the tags of projects through the GitLab API.
+type GitLabTags struct {
+	Client *gitlab.Client
+}
+
+func (g GitLabTags) ListProjectTags(ctx context.Context, projectPath string) ([]gitlab.Tag, error) {
+	p, err := g.Client.GetProjectFromPath(ctx, projectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project %s: %w", projectPath, err)
+	}
+
+	return g.Client.ListTags(ctx, p.ID)
+}
+
+// TemplateVersions is a project other projects include together with its
+// released versions and the version every consumer is on.
+type TemplateVersions struct {
+	Project   string     `json:"project"`
+	Latest    string     `json:"latest"`
+	Tags      []string   `json:"tags"`
+	Consumers []Consumer `json:"consumers"`
+}
+
+// Consumer is a single include of a template project. Version is the tag the
+// ref of the include corresponds to, the distance to the latest release is
+// given on the highest level that differs.
+type Consumer struct {
+	Project     string   `json:"project"`
+	SourceRef   string   `json:"source_ref"`
+	Files       []string `json:"files,omitempty"`
+	Component   string   `json:"component,omitempty"`
+	Ref         string   `json:"ref"`
+	Version     string   `json:"version,omitempty"`
+	Status      string   `json:"status"`
+	MajorBehind int      `json:"major_behind"`
+	MinorBehind int      `json:"minor_behind"`
+	PatchBehind int      `json:"patch_behind"`
+}
+
+// releaseTag is a tag of a template project that is a semantic version.
+type releaseTag struct {
+	name    string
+	sha     string
+	version semver.Version
+}
+
+// Outdated compares the ref every include points to against the tags of the
+// included project, templates without a single version tag are reported with
+// all of their consumers as unknown. So are templates whose tags cannot be
+// listed, like projects that are missing.
+func Outdated(ctx context.Context, reader storage.Reader, tags TagLister) ([]TemplateVersions, error) {
+	edges, err := reader.ListProjectIncludes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list includes: %w", err)
+	}
+
+	byTemplate := make(map[string][]storage.Edge)
+	for _, e := range edges {
+		byTemplate[e.TargetProject] = append(byTemplate[e.TargetProject], e)
+	}
+
+	templates := make([]TemplateVersions, 0, len(byTemplate))
+	for project, consumers := range byTemplate {
+		projectTags, err := tags.ListProjectTags(ctx, project)
+		if err != nil {
+			templates = append(templates, unknownVersions(project, consumers))
+			continue
+		}
+
+		templates = append(templates, templateVersions(project, releaseTags(projectTags), consumers))
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Project < templates[j].Project
+	})
+
+	return templates, nil
+}
+
+// releaseTags keeps the tags that are versions, sorted from the highest version down.
+func releaseTags(tags []gitlab.Tag) []releaseTag {
+	releases := make([]releaseTag, 0, len(tags))
+	for _, t := range tags {
+		if v, ok := semver.Parse(t.Name); ok {
+			releases = append(releases, releaseTag{name: t.Name, sha: t.Commit.ID, version: v})
+		}
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].version.Compare(releases[j].version) > 0
+	})
+
+	return releases
+}
+
+// unknownVersions reports every consumer of a template whose tags are not
+// known as unknown.
+func unknownVersions(project string, edges []storage.Edge) TemplateVersions {
+	tv := templateVersions(project, nil, edges)
+	for i := range tv.Consumers {
+		tv.Consumers[i].Status = StatusUnknown
+	}
+	return tv
+}
+
+func templateVersions(project string, releases []releaseTag, edges []storage.Edge) TemplateVersions {
+	tv := TemplateVersions{
+		Project:   project,
+		Tags:      make([]string, len(releases)),
+		Consumers: make([]Consumer, 0, len(edges)),
+	}
+
+	var latest *releaseTag
+	for i, r := range releases {
+		tv.Tags[i] = r.name
+		if latest == nil && r.version.Prerelease == "" {
+			latest = &releases[i]
+		}
+	}
+	if latest != nil {
+		tv.Latest = latest.name
+	}
+
+	for _, e := range edges {
+		tv.Consumers = append(tv.Consumers, consumerVersion(e, releases, latest))
+	}
+
+	sort.Slice(tv.Consumers, func(i, j int) bool {
+		a, b := tv.Consumers[i], tv.Consumers[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		return a.SourceRef < b.SourceRef
+	})
+
+	return tv
+}
+
+func consumerVersion(e storage.Edge, releases []releaseTag, latest *releaseTag) Consumer {
+	c := Consumer{
+		Project:   e.SourceProject,
+		SourceRef: e.SourceRef,
+		Files:     e.Files,
+		Component: e.Component,
+		Ref:       e.Ref,
+		Status:    StatusUnknown,
+	}
+
+	refType, _ := e.Properties["ref_type"].(string)
+	if refType == "branch" || refType == "HEAD" {
+		c.Status = StatusBranch
+		return c
+	}
+
+	if e.Unresolved || latest == nil {
+		return c
+	}
+
+	// Components track the latest release with `~latest`.
+	if e.Component != "" && e.Ref == "~latest" {
+		c.Version = latest.name
+		c.Status = StatusUpToDate
+		return c
+	}
+
+	sha, _ := e.Properties["sha"].(string)
+	current := matchRelease(e.Ref, sha, e.Component != "", releases)
+	if current == nil {
+		return c
+	}
+
+	c.Version = current.name
+	if current.version.Compare(latest.version) >= 0 {
+		c.Status = StatusUpToDate
+		return c
+	}
+
+	c.Status = StatusBehind
+	switch {
+	case current.version.Major != latest.version.Major:
+		c.MajorBehind = latest.version.Major - current.version.Major
+	case current.version.Minor != latest.version.Minor:
+		c.MinorBehind = latest.version.Minor - current.version.Minor
+	default:
+		c.PatchBehind = latest.version.Patch - current.version.Patch
+	}
+
+	return c
+}
+
+// matchRelease finds the release a ref points to, either by the name of the tag
+// or by the commit the ref resolved to. Components can ask for a partial version
+// which GitLab resolves to the highest release starting with it.
+func matchRelease(ref, sha string, partial bool, releases []releaseTag) *releaseTag {
+	for i, r := range releases {
+		if r.name == ref {
+			return &releases[i]
+		}
+	}
+
+	if sha != "" {
+		for i, r := range releases {
+			if r.sha == sha {
+				return &releases[i]
+			}
+		}
+	}
+
+	if partial && strings.Count(ref, ".") < 2 {
+		for i, r := range releases {
+			if r.version.Matches(ref) {
+				return &releases[i]
+			}
+		}
+	}
+
+	return nil
+}
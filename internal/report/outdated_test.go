@@ -0,0 +1,114 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/catouc/gitlab-ci-crawler/internal/gitlab"
+	"github.com/catouc/gitlab-ci-crawler/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReader struct {
+	includes []storage.Edge
+	broken   []storage.Edge
+}
+
+func (fr fakeReader) ListProjectIncludes(ctx context.Context) ([]storage.Edge, error) {
+	return fr.includes, nil
+}
+
+func (fr fakeReader) ListBrokenIncludes(ctx context.Context) ([]storage.Edge, error) {
+	return fr.broken, nil
+}
+
+type fakeTags map[string][]gitlab.Tag
+
+func (ft fakeTags) ListProjectTags(ctx context.Context, projectPath string) ([]gitlab.Tag, error) {
+	tags, ok := ft[projectPath]
+	if !ok {
+		return nil, errors.New("404 Project Not Found")
+	}
+	return tags, nil
+}
+
+func TestOutdated(t *testing.T) {
+	reader := fakeReader{includes: []storage.Edge{
+		{SourceProject: "team/a", SourceRef: "main", TargetProject: "platform/ci", Ref: "v2.1.0", Properties: map[string]interface{}{"ref_type": "tag"}},
+		{SourceProject: "team/b", SourceRef: "main", TargetProject: "platform/ci", Ref: "v1.4.0", Properties: map[string]interface{}{"ref_type": "tag"}},
+		{SourceProject: "team/c", SourceRef: "main", TargetProject: "platform/ci", Ref: "v2.0.1", Properties: map[string]interface{}{"ref_type": "tag"}},
+		{SourceProject: "team/d", SourceRef: "main", TargetProject: "platform/ci", Ref: "main", Properties: map[string]interface{}{"ref_type": "branch"}},
+		{SourceProject: "team/e", SourceRef: "main", TargetProject: "platform/ci", Ref: "3f2a9c1", Properties: map[string]interface{}{"ref_type": "sha", "sha": "3f2a9c1d"}},
+		{SourceProject: "team/f", SourceRef: "main", TargetProject: "platform/ci", Ref: "$TEMPLATE_REF", Unresolved: true},
+		{SourceProject: "team/g", SourceRef: "main", TargetProject: "platform/components", Ref: "1", Component: "sast"},
+		{SourceProject: "team/h", SourceRef: "main", TargetProject: "platform/gone", Ref: "v1.0.0", Properties: map[string]interface{}{"ref_type": "tag"}},
+	}}
+
+	tags := fakeTags{
+		"platform/ci": {
+			{Name: "v3.0.0-rc.1"},
+			{Name: "v2.1.0"},
+			{Name: "v2.0.1", Commit: gitlab.Commit{ID: "3f2a9c1d"}},
+			{Name: "v1.4.0"},
+			{Name: "nightly"},
+		},
+		"platform/components": {
+			{Name: "1.3.0"},
+			{Name: "2.0.0"},
+		},
+	}
+
+	templates, err := Outdated(context.TODO(), reader, tags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []TemplateVersions{
+		{
+			Project: "platform/ci",
+			Latest:  "v2.1.0",
+			Tags:    []string{"v3.0.0-rc.1", "v2.1.0", "v2.0.1", "v1.4.0"},
+			Consumers: []Consumer{
+				{Project: "team/a", SourceRef: "main", Ref: "v2.1.0", Version: "v2.1.0", Status: StatusUpToDate},
+				{Project: "team/b", SourceRef: "main", Ref: "v1.4.0", Version: "v1.4.0", Status: StatusBehind, MajorBehind: 1},
+				{Project: "team/c", SourceRef: "main", Ref: "v2.0.1", Version: "v2.0.1", Status: StatusBehind, MinorBehind: 1},
+				{Project: "team/d", SourceRef: "main", Ref: "main", Status: StatusBranch},
+				{Project: "team/e", SourceRef: "main", Ref: "3f2a9c1", Version: "v2.0.1", Status: StatusBehind, MinorBehind: 1},
+				{Project: "team/f", SourceRef: "main", Ref: "$TEMPLATE_REF", Status: StatusUnknown},
+			},
+		},
+		{
+			Project: "platform/components",
+			Latest:  "2.0.0",
+			Tags:    []string{"2.0.0", "1.3.0"},
+			Consumers: []Consumer{
+				{Project: "team/g", SourceRef: "main", Component: "sast", Ref: "1", Version: "1.3.0", Status: StatusBehind, MajorBehind: 1},
+			},
+		},
+		{
+			Project: "platform/gone",
+			Tags:    []string{},
+			Consumers: []Consumer{
+				{Project: "team/h", SourceRef: "main", Ref: "v1.0.0", Status: StatusUnknown},
+			},
+		},
+	}, templates)
+}
+
+func TestWriteOutdatedCSV(t *testing.T) {
+	templates := []TemplateVersions{{
+		Project: "platform/ci",
+		Latest:  "v2.1.0",
+		Tags:    []string{"v2.1.0", "v2.0.0"},
+		Consumers: []Consumer{
+			{Project: "team/a", SourceRef: "main", Files: []string{"build.yml", "test.yml"}, Ref: "v2.0.0", Version: "v2.0.0", Status: StatusBehind, MinorBehind: 1},
+		},
+	}}
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteOutdated(&out, FormatCSV, templates))
+	assert.Equal(t, "template,latest,consumer,source_ref,files,component,ref,version,status,major_behind,minor_behind,patch_behind\n"+
+		"platform/ci,v2.1.0,team/a,main,\"build.yml,test.yml\",,v2.0.0,v2.0.0,behind,0,1,0\n", out.String())
+
+	assert.Error(t, WriteOutdated(&out, "xml", templates))
+}
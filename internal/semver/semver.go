@@ -0,0 +1,122 @@
+// Package semver reads semantic versions from tags and orders them, template
+// and component releases are told apart from other tags with it.
+package semver
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version read from a tag, missing minor and
+// patch versions are treated as zero.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+// Parse reads tags like `v1.2.3`, `1.2` or `v2.0.0-rc.1`, build metadata
+// is ignored. The second return value is false for tags that are no version.
+func Parse(tag string) (Version, bool) {
+	tag = strings.TrimPrefix(tag, "v")
+	tag, _, _ = strings.Cut(tag, "+")
+
+	var v Version
+	tag, v.Prerelease, _ = strings.Cut(tag, "-")
+
+	parts := strings.Split(tag, ".")
+	if len(parts) > 3 {
+		return Version{}, false
+	}
+
+	numbers := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, false
+		}
+		numbers[i] = n
+	}
+
+	v.Major, v.Minor, v.Patch = numbers[0], numbers[1], numbers[2]
+	return v, true
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or higher than o. Pre-releases
+// are lower than the release they lead up to and are compared by their
+// dot-separated identifiers.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	default:
+		return comparePrerelease(v.Prerelease, o.Prerelease)
+	}
+}
+
+// comparePrerelease compares pre-releases like semver does: identifiers that
+// are both numbers are compared numerically, numbers are lower than other
+// identifiers, which are compared as strings, and more identifiers are higher.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil && bErr != nil:
+			return -1
+		case aErr != nil && bErr == nil:
+			return 1
+		case aErr != nil && bErr != nil && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Matches tells if v is a release with the major, or major and minor version
+// of partial, like `1` or `1.2`. Full versions have to be equal.
+func (v Version) Matches(partial string) bool {
+	p, ok := Parse(partial)
+	if !ok || v.Prerelease != "" {
+		return false
+	}
+
+	switch strings.Count(strings.TrimPrefix(partial, "v"), ".") {
+	case 0:
+		return v.Major == p.Major
+	case 1:
+		return v.Major == p.Major && v.Minor == p.Minor
+	default:
+		return v.Compare(p) == 0
+	}
+}
@@ -0,0 +1,58 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testData := []struct {
+		Tag      string
+		Expected Version
+		OK       bool
+	}{
+		{Tag: "v1.2.3", Expected: Version{Major: 1, Minor: 2, Patch: 3}, OK: true},
+		{Tag: "1.2", Expected: Version{Major: 1, Minor: 2}, OK: true},
+		{Tag: "v2.0.0-rc.1+build.5", Expected: Version{Major: 2, Prerelease: "rc.1"}, OK: true},
+		{Tag: "nightly", OK: false},
+		{Tag: "v1.2.3.4", OK: false},
+	}
+
+	for _, td := range testData {
+		t.Run(td.Tag, func(t *testing.T) {
+			v, ok := Parse(td.Tag)
+			assert.Equal(t, td.OK, ok)
+			assert.Equal(t, td.Expected, v)
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	parse := func(tag string) Version {
+		v, _ := Parse(tag)
+		return v
+	}
+
+	assert.Equal(t, -1, parse("v1.2.3").Compare(parse("v1.10.0")))
+	assert.Equal(t, 1, parse("v2.0.0").Compare(parse("v2.0.0-rc.1")))
+	assert.Equal(t, -1, parse("v2.0.0-rc.1").Compare(parse("v2.0.0-rc.2")))
+	assert.Equal(t, -1, parse("v2.0.0-rc.9").Compare(parse("v2.0.0-rc.10")))
+	assert.Equal(t, 1, parse("v2.0.0-rc.1").Compare(parse("v2.0.0-beta.2")))
+	assert.Equal(t, -1, parse("v2.0.0-rc").Compare(parse("v2.0.0-rc.1")))
+	assert.Equal(t, -1, parse("v2.0.0-1").Compare(parse("v2.0.0-rc")))
+	assert.Equal(t, 0, parse("v1.0").Compare(parse("1.0.0")))
+}
+
+func TestVersionMatches(t *testing.T) {
+	v, _ := Parse("v1.2.3")
+	assert.True(t, v.Matches("1"))
+	assert.True(t, v.Matches("1.2"))
+	assert.True(t, v.Matches("1.2.3"))
+	assert.False(t, v.Matches("1.3"))
+	assert.False(t, v.Matches("2"))
+	assert.False(t, v.Matches("~latest"))
+
+	rc, _ := Parse("v1.3.0-rc.1")
+	assert.False(t, rc.Matches("1"))
+}
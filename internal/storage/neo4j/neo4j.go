@@ -2,6 +2,7 @@ package neo4j
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ardanlabs/conf/v3"
@@ -58,75 +59,390 @@ func (s *Storage) CreateProjectNode(_ context.Context, projectPath string) error
 	parameters := map[string]interface{}{
 		"projectPath": projectPath,
 	}
-	_, err := s.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
-		result, err := transaction.Run(cypher, parameters)
-		if err != nil {
-			return nil, err
-		}
+	return s.write(cypher, parameters, 15*time.Second)
+}
 
-		if result.Next() {
-			return nil, nil
-		}
+func (s *Storage) CreateUnresolvedNode(_ context.Context, name string) error {
+	cypher := "MERGE (u:Unresolved {name: $name})"
+	parameters := map[string]interface{}{
+		"name": name,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
 
-		return nil, result.Err()
-	}, func(config *neo4jDriver.TransactionConfig) {
-		config.Timeout = 15 * time.Second
-	})
-	return err
+// CreateMissingProjectNode adds the MissingProject label to the project so the
+// edges pointing to it stay in place.
+func (s *Storage) CreateMissingProjectNode(_ context.Context, project, reason string) error {
+	cypher := "MERGE (p:Project {name: $projectPath})\nSET p:MissingProject, p.missing_reason = $reason"
+	parameters := map[string]interface{}{
+		"projectPath": project,
+		"reason":      reason,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateRemoteFileNode(_ context.Context, url string) error {
+	cypher := "MERGE (r:RemoteFile {url: $url})"
+	parameters := map[string]interface{}{
+		"url": url,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateTemplateNode(_ context.Context, name string) error {
+	cypher := "MERGE (t:Template {name: $name})"
+	parameters := map[string]interface{}{
+		"name": name,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateFileNode(_ context.Context, file storage.File) error {
+	inputNames := make([]string, len(file.Inputs))
+	for i, input := range file.Inputs {
+		inputNames[i] = input.Name
+	}
+
+	spec, err := json.Marshal(file.Inputs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+
+	cypher := "MERGE (p:Project {name: $project})\nMERGE (f:File {id: $id})\nSET f.project = $project, f.path = $path, f.ref = $ref, f.inputs = $inputs, f.spec = $spec\nMERGE (p)-[:CONTAINS]->(f)"
+	parameters := map[string]interface{}{
+		"id":      storage.FileID(file.Project, file.Path, file.Ref),
+		"project": file.Project,
+		"path":    file.Path,
+		"ref":     file.Ref,
+		"inputs":  inputNames,
+		"spec":    string(spec),
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateJobNode(_ context.Context, job storage.Job) error {
+	cypher := "MATCH " + nodePattern("f", job.FileType, "fileID") + "\nMERGE (j:Job {id: $id})\nSET j.name = $name\nMERGE (j)-[:DEFINED_IN]->(f)"
+	parameters := map[string]interface{}{
+		"id":     storage.JobID(job.FileID, job.Name),
+		"name":   job.Name,
+		"fileID": job.FileID,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateDynamicPipelineNode(_ context.Context, pipeline storage.DynamicPipeline) error {
+	cypher := "MERGE (d:DynamicPipeline {id: $id})\nSET d.job = $job, d.artifact = $artifact"
+	parameters := map[string]interface{}{
+		"id":       storage.DynamicPipelineID(pipeline.FileID, pipeline.Job, pipeline.Artifact),
+		"job":      pipeline.Job,
+		"artifact": pipeline.Artifact,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+func (s *Storage) CreateImageNode(_ context.Context, image storage.Image) error {
+	cypher := "MERGE (i:Image {id: $id})\nSET i.registry = $registry, i.repository = $repository, i.tag = $tag, i.digest = $digest"
+	parameters := map[string]interface{}{
+		"id":         storage.ImageID(image),
+		"registry":   image.Registry,
+		"repository": image.Repository,
+		"tag":        image.Tag,
+		"digest":     image.Digest,
+	}
+	return s.write(cypher, parameters, 15*time.Second)
 }
 
 func (s *Storage) CreateIncludeEdge(_ context.Context, include storage.Edge) error {
-	cypher := "MATCH (p:Project {name: $sourceProject})\nMATCH (p2:Project {name: $targetProject})\nMERGE (p)-[rel:INCLUDES {ref: $ref, files:$files}]->(p2)"
+	cypher := matchEdgeNodes(include) + "\nMERGE (p)-[rel:INCLUDES {source_ref: $sourceRef, ref: $ref, files:$files}]->(p2)\nSET rel.unresolved = $unresolved, rel += $properties"
 	parameters := map[string]interface{}{
 		"sourceProject": include.SourceProject,
 		"targetProject": include.TargetProject,
+		"sourceRef":     include.SourceRef,
 		"ref":           include.Ref,
 		"files":         strings.Join(include.Files, ","),
+		"unresolved":    include.Unresolved,
+		"properties":    edgeProperties(include.Properties),
 	}
-	_, err := s.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
-		result, err := transaction.Run(cypher, parameters)
-		if err != nil {
-			return nil, err
-		}
+	return s.writeEdge(include.Pipeline, cypher, parameters)
+}
 
-		if result.Next() {
-			return nil, nil
-		}
+func (s *Storage) CreateBrokenIncludeEdge(_ context.Context, edge storage.Edge) error {
+	reason, _ := edge.Properties["reason"].(string)
 
-		return nil, result.Err()
-	}, func(config *neo4jDriver.TransactionConfig) {
-		config.Timeout = 15 * time.Second
-	})
-	return err
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:BROKEN_INCLUDE {source_ref: $sourceRef, ref: $ref, files: $files, reason: $reason}]->(p2)\nSET rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
+		"ref":           edge.Ref,
+		"files":         strings.Join(edge.Files, ","),
+		"reason":        reason,
+		"properties":    edgeProperties(edge.Properties),
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateComponentIncludeEdge(_ context.Context, include storage.Edge) error {
+	cypher := matchEdgeNodes(include) + "\nMERGE (p)-[rel:INCLUDES_COMPONENT {source_ref: $sourceRef, component: $component, version: $version, files: $files}]->(p2)\nSET rel.unresolved = $unresolved, rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": include.SourceProject,
+		"targetProject": include.TargetProject,
+		"sourceRef":     include.SourceRef,
+		"component":     include.Component,
+		"version":       include.Ref,
+		"files":         strings.Join(include.Files, ","),
+		"unresolved":    include.Unresolved,
+		"properties":    edgeProperties(include.Properties),
+	}
+	return s.writeEdge(include.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateInputMismatchEdge(_ context.Context, edge storage.Edge) error {
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:INPUT_MISMATCH {source_ref: $sourceRef}]->(p2)\nSET rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
+		"properties":    edgeProperties(edge.Properties),
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateExtendsEdge(_ context.Context, edge storage.Edge) error {
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:EXTENDS]->(p2)"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateReferenceEdge(_ context.Context, edge storage.Edge) error {
+	path, _ := edge.Properties["path"].([]string)
+	if path == nil {
+		path = []string{}
+	}
+
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:REFERENCES {path: $path}]->(p2)"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"path":          path,
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateNeedsArtifactsEdge(_ context.Context, edge storage.Edge) error {
+	job, _ := edge.Properties["job"].(string)
+	sourceJob, _ := edge.Properties["source_job"].(string)
+
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:NEEDS_ARTIFACTS {source_ref: $sourceRef, ref: $ref, job: $job, source_job: $sourceJob}]->(p2)\nSET rel.unresolved = $unresolved, rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
+		"ref":           edge.Ref,
+		"job":           job,
+		"sourceJob":     sourceJob,
+		"unresolved":    edge.Unresolved,
+		"properties":    edgeProperties(edge.Properties),
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
 }
 
 func (s *Storage) CreateTriggerEdge(_ context.Context, edge storage.Edge) error {
-	cypher := "MATCH (p:Project {name: $sourceProject})\nMATCH (p2:Project {name: $targetProject})\nMERGE (p)-[rel:TRIGGERS {ref: $ref}]->(p2)"
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:TRIGGERS {source_ref: $sourceRef, ref: $ref}]->(p2)\nSET rel.unresolved = $unresolved, rel += $properties"
 	parameters := map[string]interface{}{
 		"sourceProject": edge.SourceProject,
 		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
 		"ref":           edge.Ref,
+		"unresolved":    edge.Unresolved,
+		"properties":    edgeProperties(edge.Properties),
 	}
-	_, err := s.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateChildPipelineEdge(_ context.Context, edge storage.Edge) error {
+	job, _ := edge.Properties["job"].(string)
+
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:CHILD_PIPELINE {source_ref: $sourceRef, job: $job}]->(p2)\nSET rel.ref = $ref, rel.files = $files, rel.unresolved = $unresolved, rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
+		"job":           job,
+		"ref":           edge.Ref,
+		"files":         strings.Join(edge.Files, ","),
+		"unresolved":    edge.Unresolved,
+		"properties":    edgeProperties(edge.Properties),
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+func (s *Storage) CreateUsesImageEdge(_ context.Context, edge storage.Edge) error {
+	job, _ := edge.Properties["job"].(string)
+	file, _ := edge.Properties["file"].(string)
+	service, _ := edge.Properties["service"].(bool)
+
+	cypher := matchEdgeNodes(edge) + "\nMERGE (p)-[rel:USES_IMAGE {source_ref: $sourceRef, job: $job, file: $file, service: $service}]->(p2)\nSET rel.unresolved = $unresolved, rel += $properties"
+	parameters := map[string]interface{}{
+		"sourceProject": edge.SourceProject,
+		"targetProject": edge.TargetProject,
+		"sourceRef":     edge.SourceRef,
+		"job":           job,
+		"file":          file,
+		"service":       service,
+		"unresolved":    edge.Unresolved,
+		"properties":    edgeProperties(edge.Properties),
+	}
+	return s.writeEdge(edge.Pipeline, cypher, parameters)
+}
+
+// pipelineEdgeTypes are the relationships that are tagged with the pipelines
+// they were found by, see writeEdge.
+var pipelineEdgeTypes = []string{
+	"INCLUDES",
+	"BROKEN_INCLUDE",
+	"INCLUDES_COMPONENT",
+	"INPUT_MISMATCH",
+	"EXTENDS",
+	"REFERENCES",
+	"NEEDS_ARTIFACTS",
+	"TRIGGERS",
+	"CHILD_PIPELINE",
+	"USES_IMAGE",
+}
+
+// RemoveProjectEdges removes the pipelines of the project from the edges they
+// were found by and deletes the edges no other pipeline found. Only the
+// relationship types tagged with pipelines are looked at, the CONTAINS edges
+// to files and the edges between files and their jobs carry none and are kept.
+func (s *Storage) RemoveProjectEdges(_ context.Context, project string, refs []string) error {
+	pipelines := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		pipelines = append(pipelines, storage.PipelineID(project, ref))
+	}
+
+	cypher := `MATCH ()-[rel:` + strings.Join(pipelineEdgeTypes, "|") + `]->()
+WHERE any(p IN coalesce(rel.pipelines, []) WHERE p IN $pipelines)
+SET rel.pipelines = [p IN rel.pipelines WHERE NOT p IN $pipelines]
+WITH rel
+WHERE size(rel.pipelines) = 0
+DELETE rel`
+	parameters := map[string]interface{}{
+		"pipelines": pipelines,
+	}
+	return s.write(cypher, parameters, 60*time.Second)
+}
+
+func (s *Storage) RemoveAll(_ context.Context) error {
+	cypher := "MATCH (n) DETACH DELETE n"
+	parameters := map[string]interface{}{}
+	return s.write(cypher, parameters, 60*time.Second)
+}
+
+func (s *Storage) ListProjectIncludes(_ context.Context) ([]storage.Edge, error) {
+	cypher := `MATCH (p:Project)-[rel:INCLUDES|INCLUDES_COMPONENT]->(t:Project)
+WHERE p.name <> t.name
+RETURN p.name AS source, rel.source_ref AS sourceRef, t.name AS target,
+	coalesce(rel.ref, rel.version) AS ref, rel.files AS files, rel.component AS component,
+	rel.unresolved AS unresolved, rel.sha AS sha, rel.ref_type AS refType`
+
+	records, err := s.read(cypher, map[string]interface{}{}, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]storage.Edge, 0, len(records))
+	for _, r := range records {
+		edge := storage.Edge{
+			SourceProject: stringValue(r, "source"),
+			SourceRef:     stringValue(r, "sourceRef"),
+			TargetProject: stringValue(r, "target"),
+			Ref:           stringValue(r, "ref"),
+			Component:     stringValue(r, "component"),
+			Properties: map[string]interface{}{
+				"sha":      stringValue(r, "sha"),
+				"ref_type": stringValue(r, "refType"),
+			},
+		}
+
+		if files := stringValue(r, "files"); files != "" {
+			edge.Files = strings.Split(files, ",")
+		}
+
+		if unresolved, ok := r.AsMap()["unresolved"].(bool); ok {
+			edge.Unresolved = unresolved
+		}
+
+		edges = append(edges, edge)
+	}
+
+	return edges, nil
+}
+
+func (s *Storage) ListBrokenIncludes(_ context.Context) ([]storage.Edge, error) {
+	cypher := `MATCH (p:Project)-[rel:BROKEN_INCLUDE]->(t:Project)
+RETURN p.name AS source, rel.source_ref AS sourceRef, t.name AS target, rel.ref AS ref,
+	rel.files AS files, rel.reason AS reason, rel.included_by AS includedBy`
+
+	records, err := s.read(cypher, map[string]interface{}{}, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]storage.Edge, 0, len(records))
+	for _, r := range records {
+		edge := storage.Edge{
+			SourceProject: stringValue(r, "source"),
+			SourceRef:     stringValue(r, "sourceRef"),
+			TargetProject: stringValue(r, "target"),
+			Ref:           stringValue(r, "ref"),
+			Properties: map[string]interface{}{
+				"reason":      stringValue(r, "reason"),
+				"included_by": stringValue(r, "includedBy"),
+			},
+		}
+
+		if files := stringValue(r, "files"); files != "" {
+			edge.Files = strings.Split(files, ",")
+		}
+
+		edges = append(edges, edge)
+	}
+
+	return edges, nil
+}
+
+// read runs a single cypher query inside a read transaction and returns all records.
+func (s *Storage) read(cypher string, parameters map[string]interface{}, timeout time.Duration) ([]*neo4j.Record, error) {
+	records, err := s.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 		result, err := transaction.Run(cypher, parameters)
 		if err != nil {
 			return nil, err
 		}
 
-		if result.Next() {
-			return nil, nil
-		}
-
-		return nil, result.Err()
+		return result.Collect()
 	}, func(config *neo4jDriver.TransactionConfig) {
-		config.Timeout = 15 * time.Second
+		config.Timeout = timeout
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return records.([]*neo4j.Record), nil
 }
 
-func (s *Storage) RemoveAll(_ context.Context) error {
-	cypher := "MATCH (n) DETACH DELETE n"
-	parameters := map[string]interface{}{}
+// stringValue returns a string column of a record, missing values and
+// nulls are returned as an empty string.
+func stringValue(record *neo4j.Record, key string) string {
+	v, _ := record.AsMap()[key].(string)
+	return v
+}
+
+// write runs a single cypher statement inside a write transaction.
+func (s *Storage) write(cypher string, parameters map[string]interface{}, timeout time.Duration) error {
 	_, err := s.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 		result, err := transaction.Run(cypher, parameters)
 		if err != nil {
@@ -139,7 +455,71 @@ func (s *Storage) RemoveAll(_ context.Context) error {
 
 		return nil, result.Err()
 	}, func(config *neo4jDriver.TransactionConfig) {
-		config.Timeout = 60 * time.Second
+		config.Timeout = timeout
 	})
 	return err
 }
+
+// writeEdge runs the cypher statement creating an edge bound to `rel` and adds
+// the pipeline to the pipelines the edge was found by. The same edge is usually
+// found by many pipelines, for example the includes inside of a template.
+func (s *Storage) writeEdge(pipeline, cypher string, parameters map[string]interface{}) error {
+	if pipeline != "" {
+		cypher += "\nSET rel.pipelines = CASE WHEN $pipeline IN coalesce(rel.pipelines, []) THEN rel.pipelines ELSE coalesce(rel.pipelines, []) + $pipeline END"
+		parameters["pipeline"] = pipeline
+	}
+	return s.write(cypher, parameters, 15*time.Second)
+}
+
+// edgeProperties converts the generic properties of an edge into values
+// Neo4j can store. Properties can only be primitives or lists of them,
+// everything else is stored as its JSON representation.
+func edgeProperties(properties map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(properties))
+	for k, v := range properties {
+		switch val := v.(type) {
+		case nil:
+			continue
+		case string, bool, int, int64, float64, []string:
+			converted[k] = val
+		default:
+			b, err := json.Marshal(val)
+			if err != nil {
+				converted[k] = fmt.Sprint(val)
+				continue
+			}
+			converted[k] = string(b)
+		}
+	}
+	return converted
+}
+
+// matchEdgeNodes builds the MATCH clauses for both ends of an edge, binding the
+// source node to `p` and the target node to `p2`.
+// Labels cannot be passed as parameters so they are taken from the fixed set
+// of storage.NodeType values.
+func matchEdgeNodes(edge storage.Edge) string {
+	return "MATCH " + nodePattern("p", edge.SourceType, "sourceProject") +
+		"\nMATCH " + nodePattern("p2", edge.TargetType, "targetProject")
+}
+
+func nodePattern(variable string, nodeType storage.NodeType, parameter string) string {
+	switch nodeType {
+	case storage.NodeTypeRemoteFile:
+		return fmt.Sprintf("(%s:RemoteFile {url: $%s})", variable, parameter)
+	case storage.NodeTypeTemplate:
+		return fmt.Sprintf("(%s:Template {name: $%s})", variable, parameter)
+	case storage.NodeTypeFile:
+		return fmt.Sprintf("(%s:File {id: $%s})", variable, parameter)
+	case storage.NodeTypeJob:
+		return fmt.Sprintf("(%s:Job {id: $%s})", variable, parameter)
+	case storage.NodeTypeDynamicPipeline:
+		return fmt.Sprintf("(%s:DynamicPipeline {id: $%s})", variable, parameter)
+	case storage.NodeTypeImage:
+		return fmt.Sprintf("(%s:Image {id: $%s})", variable, parameter)
+	case storage.NodeTypeUnresolved:
+		return fmt.Sprintf("(%s:Unresolved {name: $%s})", variable, parameter)
+	default:
+		return fmt.Sprintf("(%s:Project {name: $%s})", variable, parameter)
+	}
+}
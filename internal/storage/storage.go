@@ -4,13 +4,151 @@ import "context"
 
 // TODO: maybe add metadata passing options
 
+// NodeType describes what kind of node an edge is pointing from or to.
+// The zero value is treated as NodeTypeProject to keep existing callers working.
+type NodeType string
+
+const (
+	NodeTypeProject    NodeType = "Project"
+	NodeTypeRemoteFile NodeType = "RemoteFile"
+	NodeTypeTemplate   NodeType = "Template"
+	NodeTypeFile       NodeType = "File"
+	NodeTypeJob        NodeType = "Job"
+	// NodeTypeDynamicPipeline is a child pipeline whose configuration is
+	// generated by a job and only exists once the parent pipeline ran.
+	NodeTypeDynamicPipeline NodeType = "DynamicPipeline"
+	NodeTypeImage           NodeType = "Image"
+	// NodeTypeUnresolved is a project whose path still contains variables
+	// the crawler could not expand, it is kept apart from real projects.
+	NodeTypeUnresolved NodeType = "Unresolved"
+)
+
+// The reasons a project cannot be looked up.
+const (
+	MissingReasonNotFound  = "not found"
+	MissingReasonForbidden = "forbidden"
+)
+
+// The reasons an include points to something that cannot be read, a pipeline
+// with such an include fails the next time it runs.
+const (
+	BrokenReasonFileMissing    = "file missing at ref"
+	BrokenReasonProjectMissing = "project missing"
+	BrokenReasonForbidden      = "no access"
+	BrokenReasonRefMissing     = "ref missing"
+)
+
+// FileID builds the identity of a File node from the project the file lives
+// in, its path inside the repository and the ref it was read at.
+func FileID(project, path, ref string) string {
+	return project + ":" + path + "@" + ref
+}
+
+// PipelineID builds the identity of the pipeline of a project on a ref.
+func PipelineID(project, ref string) string {
+	return project + "@" + ref
+}
+
+// JobID builds the identity of a Job node from the identity
+// of the node of the file it is defined in and its name.
+func JobID(fileID, name string) string {
+	return fileID + "#" + name
+}
+
+// DynamicPipelineID builds the identity of a DynamicPipeline node from the file
+// that triggers it, the job generating its configuration and the artifact holding it.
+func DynamicPipelineID(fileID, job, artifact string) string {
+	return JobID(fileID, job) + ":" + artifact
+}
+
+// DynamicPipeline is a child pipeline started from an artifact, FileID is the
+// identity of the node of the file that triggers the pipeline.
+type DynamicPipeline struct {
+	FileID   string
+	Job      string
+	Artifact string
+}
+
+// ImageID builds the identity of an Image node from the parts of its reference,
+// tag and digest are left out when they are empty.
+func ImageID(image Image) string {
+	id := image.Repository
+	if image.Registry != "" {
+		id = image.Registry + "/" + id
+	}
+	if image.Tag != "" {
+		id += ":" + image.Tag
+	}
+	if image.Digest != "" {
+		id += "@" + image.Digest
+	}
+	return id
+}
+
+// Image is a container image used by a job, either as the image the job
+// runs in or as a service next to it.
+type Image struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Job is a job defined in a CI file, FileType and FileID point
+// to the node of the file the job is defined in.
+type Job struct {
+	Name     string
+	FileType NodeType
+	FileID   string
+}
+
+// File is a CI file inside of a project, Inputs are the inputs
+// declared in its `spec:` header.
+type File struct {
+	Project string
+	Path    string
+	Ref     string
+	Inputs  []Input
+}
+
+// Input is a single input declared in the `spec:inputs` of a CI file.
+type Input struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Options     []interface{} `json:"options,omitempty"`
+	Required    bool          `json:"required"`
+}
+
 // Edge holds all relevant information to create meaningful
 // edges inside the storage system for querying.
+// SourceProject and TargetProject hold the identity of the node,
+// for projects that is the path with namespace, for remote files the URL
+// for GitLab's built-in templates the template name and for files
+// the FileID and for jobs the JobID.
 type Edge struct {
+	SourceType    NodeType
 	SourceProject string
+	// SourceRef is the branch or tag the source's CI file was read at,
+	// the same file can have different edges on different refs.
+	SourceRef string
+	// Pipeline is the PipelineID of the pipeline whose crawl found the edge,
+	// edges of included files are found by the pipelines of every consumer.
+	Pipeline      string
+	TargetType    NodeType
 	TargetProject string
 	Ref           string
 	Files         []string
+	// Component is the name of the CI/CD component for component includes,
+	// Ref then holds the version the consumer requested.
+	Component string
+	// Unresolved marks edges whose target still contains CI/CD variables
+	// the crawler could not expand.
+	Unresolved bool
+	// Properties holds additional data for the edge, values that the
+	// storage cannot store natively are serialised by it.
+	Properties map[string]interface{}
 }
 
 type Storage interface {
@@ -18,16 +156,107 @@ type Storage interface {
 	// creating a node inside the storage.
 	CreateProjectNode(ctx context.Context, projectPath string) error
 
+	// CreateUnresolvedNode creates a node for a project path that still
+	// contains variables, keyed by the path as it was written.
+	CreateUnresolvedNode(ctx context.Context, name string) error
+
+	// CreateRemoteFileNode creates a node for a file that was included
+	// through `include:remote`, the URL is the identity of the node.
+	CreateRemoteFileNode(ctx context.Context, url string) error
+
+	// CreateTemplateNode creates a node for one of GitLab's built-in
+	// templates included through `include:template`, keyed by the template name.
+	CreateTemplateNode(ctx context.Context, name string) error
+
+	// CreateFileNode creates a node for a CI file inside of a project
+	// holding the inputs the file declares, keyed by its FileID.
+	CreateFileNode(ctx context.Context, file File) error
+
+	// CreateJobNode creates a node for a job keyed by its JobID and
+	// connects it to the node of the file it is defined in.
+	CreateJobNode(ctx context.Context, job Job) error
+
+	// CreateDynamicPipelineNode creates a node for a child pipeline that is
+	// generated at runtime, keyed by its DynamicPipelineID.
+	CreateDynamicPipelineNode(ctx context.Context, pipeline DynamicPipeline) error
+
+	// CreateImageNode creates a node for a container image keyed by its ImageID.
+	CreateImageNode(ctx context.Context, image Image) error
+
+	// CreateMissingProjectNode marks a project that is included or triggered
+	// but cannot be looked up in GitLab, reason is one of the MissingReason values.
+	CreateMissingProjectNode(ctx context.Context, project, reason string) error
+
 	// CreateIncludeEdge is responsible for creating the include edges
 	// inside of the storage, include edges should have the
 	// `ref` and `files` fields set to allow for queries based
-	// on the data.
+	// on the data. Once the ref was resolved the `sha` it pointed
+	// to and its `ref_type` are part of the properties.
 	CreateIncludeEdge(ctx context.Context, include Edge) error
 
+	// CreateBrokenIncludeEdge records an include that cannot be read between
+	// the project whose pipeline breaks and the included project. The edge
+	// carries the `reason`, one of the BrokenReason values, and `included_by`
+	// if the include is not in the project's own CI file.
+	CreateBrokenIncludeEdge(ctx context.Context, edge Edge) error
+
+	// CreateComponentIncludeEdge creates the edge for an `include:component`
+	// between the consumer and the project backing the component, the edge
+	// carries the component name and the requested version.
+	CreateComponentIncludeEdge(ctx context.Context, include Edge) error
+
+	// CreateInputMismatchEdge records that a file includes another file passing
+	// inputs that do not match the included file's spec, the edge carries
+	// the `unknown_inputs` and `missing_inputs` properties.
+	CreateInputMismatchEdge(ctx context.Context, edge Edge) error
+
+	// CreateExtendsEdge creates the edge between a job and a
+	// job it uses through `extends:`.
+	CreateExtendsEdge(ctx context.Context, edge Edge) error
+
+	// CreateReferenceEdge creates the edge between a job and a job it
+	// uses through a `!reference` tag, the edge carries the referenced `path`.
+	CreateReferenceEdge(ctx context.Context, edge Edge) error
+
+	// CreateNeedsArtifactsEdge creates the edge for a `needs:project` or
+	// `needs:pipeline` entry, the edge carries the needed `job`, the
+	// `source_job` that has the need and whether `artifacts` are fetched.
+	CreateNeedsArtifactsEdge(ctx context.Context, edge Edge) error
+
 	// CreateTriggerEdge is responsible for creating the edges for triggers
 	// inside of the storage
 	CreateTriggerEdge(ctx context.Context, include Edge) error
 
+	// CreateChildPipelineEdge creates the edge between a file and the
+	// configuration of a child pipeline it triggers, the edge carries the
+	// triggering `job` together with its `strategy` and `forward` options.
+	CreateChildPipelineEdge(ctx context.Context, edge Edge) error
+
+	// CreateUsesImageEdge creates the edge between a project and an image
+	// its pipeline runs, the edge carries the `job` and `file` using the
+	// image and whether the image is a `service`.
+	CreateUsesImageEdge(ctx context.Context, edge Edge) error
+
+	// RemoveProjectEdges forgets the edges found by the pipelines of the
+	// project on the given refs, wherever they start, so a project that
+	// changed can be written again without leaving stale edges behind.
+	// Edges that pipelines of other projects found as well are kept.
+	RemoveProjectEdges(ctx context.Context, project string, refs []string) error
+
 	// RemoveAll will delete all nodes & edges
 	RemoveAll(ctx context.Context) error
 }
+
+// Reader is implemented by storages that can answer the queries
+// of the reports, the crawler itself only ever writes.
+type Reader interface {
+	// ListProjectIncludes returns the INCLUDES and INCLUDES_COMPONENT edges
+	// between two different projects. Component includes have Component
+	// set and their version in Ref, resolved refs carry the `sha` and
+	// `ref_type` properties.
+	ListProjectIncludes(ctx context.Context) ([]Edge, error)
+
+	// ListBrokenIncludes returns all BROKEN_INCLUDE edges with their
+	// `reason` and `included_by` properties.
+	ListBrokenIncludes(ctx context.Context) ([]Edge, error)
+}